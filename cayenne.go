@@ -0,0 +1,121 @@
+package nbiot
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// lppType is a Cayenne LPP data type.
+type lppType struct {
+	name   string
+	size   int
+	decode func(b []byte) interface{}
+}
+
+// lppTypes are the Cayenne LPP data types by their IDs.
+var lppTypes = map[byte]lppType{
+	0:   {"digital_input", 1, lppUnsigned(1)},
+	1:   {"digital_output", 1, lppUnsigned(1)},
+	2:   {"analog_input", 2, lppSigned(0.01)},
+	3:   {"analog_output", 2, lppSigned(0.01)},
+	100: {"generic_sensor", 4, lppUnsigned(1)},
+	101: {"illuminance", 2, lppUnsigned(1)},
+	102: {"presence", 1, lppUnsigned(1)},
+	103: {"temperature", 2, lppSigned(0.1)},
+	104: {"humidity", 1, lppUnsigned(0.5)},
+	113: {"accelerometer", 6, lppVector(0.001, "x", "y", "z")},
+	115: {"barometer", 2, lppUnsigned(0.1)},
+	116: {"voltage", 2, lppUnsigned(0.01)},
+	117: {"current", 2, lppUnsigned(0.001)},
+	118: {"frequency", 4, lppUnsigned(1)},
+	120: {"percentage", 1, lppUnsigned(1)},
+	121: {"altitude", 2, lppSigned(1)},
+	125: {"concentration", 2, lppUnsigned(1)},
+	128: {"power", 2, lppUnsigned(1)},
+	130: {"distance", 4, lppUnsigned(0.001)},
+	131: {"energy", 4, lppUnsigned(0.001)},
+	132: {"direction", 2, lppUnsigned(1)},
+	133: {"unixtime", 4, lppUnsigned(1)},
+	134: {"gyrometer", 6, lppVector(0.01, "x", "y", "z")},
+	135: {"colour", 3, lppColour},
+	136: {"gps", 9, lppGPS},
+	142: {"switch", 1, lppUnsigned(1)},
+}
+
+// decodeCayenneLPP decodes Cayenne Low Power Payload, which is a sequence of
+// channel, type and value.
+func decodeCayenneLPP(payload []byte) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for len(payload) > 0 {
+		if len(payload) < 2 {
+			return nil, fmt.Errorf("nbiot: decoding Cayenne LPP payload: truncated header")
+		}
+		channel, id := payload[0], payload[1]
+		t, ok := lppTypes[id]
+		if !ok {
+			return nil, fmt.Errorf("nbiot: decoding Cayenne LPP payload: unknown type %d on channel %d", id, channel)
+		}
+		payload = payload[2:]
+		if len(payload) < t.size {
+			return nil, fmt.Errorf("nbiot: decoding Cayenne LPP payload: truncated %s on channel %d", t.name, channel)
+		}
+		fields[fmt.Sprintf("%s_%d", t.name, channel)] = t.decode(payload[:t.size])
+		payload = payload[t.size:]
+	}
+	return fields, nil
+}
+
+// lppInt returns a big endian integer of 1 to 4 bytes.
+func lppInt(b []byte, signed bool) int64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	if bits := uint(8 * len(b)); signed && v&(1<<(bits-1)) != 0 {
+		return int64(v) - 1<<bits
+	}
+	return int64(v)
+}
+
+// lppScale returns v scaled, as an integer if the scale is 1.
+func lppScale(v int64, scale float64) interface{} {
+	if scale == 1 {
+		return v
+	}
+	return float64(v) * scale
+}
+
+func lppUnsigned(scale float64) func([]byte) interface{} {
+	return func(b []byte) interface{} {
+		return lppScale(lppInt(b, false), scale)
+	}
+}
+
+func lppSigned(scale float64) func([]byte) interface{} {
+	return func(b []byte) interface{} {
+		return lppScale(lppInt(b, true), scale)
+	}
+}
+
+// lppVector decodes a value of signed 16-bit components.
+func lppVector(scale float64, names ...string) func([]byte) interface{} {
+	return func(b []byte) interface{} {
+		v := make(map[string]interface{}, len(names))
+		for i, name := range names {
+			v[name] = float64(int16(binary.BigEndian.Uint16(b[2*i:]))) * scale
+		}
+		return v
+	}
+}
+
+func lppColour(b []byte) interface{} {
+	return map[string]interface{}{"r": int64(b[0]), "g": int64(b[1]), "b": int64(b[2])}
+}
+
+func lppGPS(b []byte) interface{} {
+	return map[string]interface{}{
+		"latitude":  float64(lppInt(b[0:3], true)) * 0.0001,
+		"longitude": float64(lppInt(b[3:6], true)) * 0.0001,
+		"altitude":  float64(lppInt(b[6:9], true)) * 0.01,
+	}
+}
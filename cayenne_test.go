@@ -0,0 +1,57 @@
+package nbiot
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+)
+
+func TestCayenneLPP(t *testing.T) {
+	for _, test := range []struct {
+		payload string
+		want    map[string]float64
+	}{
+		{"03670110056700ff", map[string]float64{"temperature_3": 27.2, "temperature_5": 25.5}},
+		{"0167ffd7", map[string]float64{"temperature_1": -4.1}},
+		{"02685403010a", map[string]float64{"humidity_2": 42, "digital_output_3": 10}},
+		{"0588065f9ff2960a0003e8", map[string]float64{"gps_5.latitude": 41.7695, "gps_5.longitude": -87.9094, "gps_5.altitude": 10}},
+		{"067104d2fb2e0000", map[string]float64{"accelerometer_6.x": 1.234, "accelerometer_6.y": -1.234, "accelerometer_6.z": 0}},
+		{"", map[string]float64{}},
+	} {
+		payload, _ := hex.DecodeString(test.payload)
+		fields, err := CayenneLPPDecoder.Decode(payload)
+		if err != nil {
+			t.Errorf("%s: %v", test.payload, err)
+			continue
+		}
+		got := make(map[string]float64)
+		for name, v := range fields {
+			switch v := v.(type) {
+			case int64:
+				got[name] = float64(v)
+			case float64:
+				got[name] = v
+			case map[string]interface{}:
+				for component, c := range v {
+					got[name+"."+component] = c.(float64)
+				}
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.payload, got, test.want)
+			continue
+		}
+		for name, want := range test.want {
+			if math.Abs(got[name]-want) > 1e-9 {
+				t.Errorf("%s: %s = %v, want %v", test.payload, name, got[name], want)
+			}
+		}
+	}
+
+	for _, payload := range []string{"03", "03ff00", "036701"} {
+		b, _ := hex.DecodeString(payload)
+		if _, err := CayenneLPPDecoder.Decode(b); err == nil {
+			t.Errorf("%s: expected error", payload)
+		}
+	}
+}
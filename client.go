@@ -7,23 +7,52 @@ package nbiot
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 // Client is a client for Telenor NB-IoT.
 type Client struct {
-	addr   string
-	token  string
-	client http.Client
+	addr      string
+	token     string
+	client    *http.Client
+	timeout   time.Duration
+	userAgent string
+	noPing    bool
+	retry     RetryPolicy
+
+	limiter       *Limiter
+	classLimiters map[EndpointClass]*Limiter
+
+	interceptors    []Interceptor
+	streamObservers []StreamObserver
+	logger          *slog.Logger
+	metrics         MetricsSink
+	decoders        *DecoderRegistry
+
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	frameHandler func(path string, frame StreamFrame)
+
+	proxy     func(*http.Request) (*url.URL, error)
+	tlsConfig *tls.Config
+	dialer    *websocket.Dialer
 }
 
 // New creates a new client with the default configuration. The default
 // configuration can be specified in a configuration file or through
 // environment variables.
-func New() (*Client, error) {
+func New(opts ...Option) (*Client, error) {
 	address, token, err := addressTokenFromConfig(ConfigFile)
 	if err != nil {
 		return nil, err
@@ -37,14 +66,29 @@ func New() (*Client, error) {
 		return nil, fmt.Errorf("No API token. Define %s environment variable or create config in %s", TokenEnvironmentVariable, ConfigFile)
 	}
 
-	return NewWithAddr(address, token)
+	return NewWithOptions(address, token, opts...)
 }
 
 // NewWithAddr creates a new client with the specified address and token.
 func NewWithAddr(addr, token string) (*Client, error) {
+	return NewWithOptions(addr, token)
+}
+
+// NewWithOptions creates a new client with the specified address, token and
+// options. Unless WithoutPing is given the API is pinged before returning.
+func NewWithOptions(addr, token string, opts ...Option) (*Client, error) {
 	c := &Client{
-		addr:  addr,
-		token: token,
+		addr:      addr,
+		token:     token,
+		client:    &http.Client{},
+		userAgent: userAgent,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.applyTransportOptions()
+	if c.noPing {
+		return c, nil
 	}
 	return c, c.ping()
 }
@@ -62,14 +106,19 @@ type SystemDefaults struct {
 
 // SystemDefaults returns the system defaults.
 func (c *Client) SystemDefaults() (SystemDefaults, error) {
+	return c.SystemDefaultsContext(context.Background())
+}
+
+// SystemDefaultsContext returns the system defaults using the provided context.
+func (c *Client) SystemDefaultsContext(ctx context.Context) (SystemDefaults, error) {
 	var cfg SystemDefaults
-	err := c.get("/system", &cfg)
+	err := c.get(ctx, "/system", &cfg)
 	return cfg, err
 }
 
 func (c *Client) ping() error {
-	err := c.get("/", nil)
-	if err, ok := err.(ClientError); ok && err.HTTPStatusCode == http.StatusForbidden {
+	err := c.get(context.Background(), "/", nil)
+	if errors.Is(err, ErrForbidden) {
 		// A token with restricted access will receive 403 Forbidden from "/"
 		// but that still indicates a succesful connection.
 		return nil
@@ -77,66 +126,128 @@ func (c *Client) ping() error {
 	return err
 }
 
-func (c *Client) get(path string, x interface{}) error {
-	return c.request(http.MethodGet, path, nil, x)
+func (c *Client) get(ctx context.Context, path string, x interface{}) error {
+	return c.request(ctx, http.MethodGet, path, nil, x)
 }
 
-func (c *Client) create(path string, x interface{}) error {
-	return c.request(http.MethodPost, path, x, x)
+func (c *Client) create(ctx context.Context, path string, x interface{}) error {
+	return c.request(ctx, http.MethodPost, path, x, x)
 }
 
-func (c *Client) update(path string, x interface{}) error {
-	return c.request(http.MethodPatch, path, x, x)
+func (c *Client) update(ctx context.Context, path string, x interface{}) error {
+	return c.request(ctx, http.MethodPatch, path, x, x)
 }
 
-func (c *Client) delete(path string) error {
-	return c.request(http.MethodDelete, path, nil, nil)
+func (c *Client) delete(ctx context.Context, path string) error {
+	return c.request(ctx, http.MethodDelete, path, nil, nil)
 }
 
-func (c *Client) request(method, path string, input, output interface{}) error {
+func (c *Client) request(ctx context.Context, method, path string, input, output interface{}) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req := c.newRequest(method, path)
+	req.Header.Set("Content-Type", "application/json")
+	req.Input = input
+	req.Output = output
+	_, err := c.chain(c.do)(ctx, req)
+	return err
+}
+
+// do is the innermost handler of the interceptor chain for REST requests.
+func (c *Client) do(ctx context.Context, req *Request) (resp *Response, err error) {
+	start := time.Now()
+	m := RequestMetrics{Method: req.Method, Route: req.Route}
+	defer func() {
+		c.logRequest(ctx, req, resp, start, err)
+		if c.metrics != nil {
+			if resp != nil {
+				m.StatusCode = resp.StatusCode
+			}
+			m.Duration = time.Since(start)
+			c.metrics.RequestDone(m)
+		}
+	}()
+
 	body := new(bytes.Buffer)
-	if input != nil {
-		if err := json.NewEncoder(body).Encode(input); err != nil {
-			return err
+	if req.Input != nil {
+		if err := json.NewEncoder(body).Encode(req.Input); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		m.Attempts = attempt
+		resp, wait, retry, err := c.attempt(ctx, attempt, req, body.Bytes(), &m)
+		if !retry {
+			return resp, err
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, &TransportError{Attempts: attempt, Err: err}
 		}
 	}
-	req, err := http.NewRequest(method, c.addr+path, body)
+}
+
+// attempt makes a single attempt at a request. If the attempt failed and the
+// retry policy allows it, it returns how long to wait before the next one.
+func (c *Client) attempt(ctx context.Context, attempt int, r *Request, body []byte, m *RequestMetrics) (*Response, time.Duration, bool, error) {
+	release, err := c.acquireLimiters(ctx, r.Method, r.Path)
 	if err != nil {
-		return err
+		return nil, 0, false, &TransportError{Attempts: attempt, Err: err}
 	}
-	req.Header.Set("X-API-Token", c.token)
-	req.Header.Set("Content-Type", "application/json")
+	defer release()
 
-	resp, err := c.client.Do(req)
+	req, err := http.NewRequestWithContext(ctx, r.Method, c.addr+r.Path, bytes.NewReader(body))
 	if err != nil {
-		return err
+		return nil, 0, false, err
 	}
-	defer resp.Body.Close()
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("X-API-Token", c.token)
 
-	if resp.StatusCode >= 300 {
-		return newClientError(resp)
+	m.BytesSent += int64(len(body))
+	resp, err := c.client.Do(req)
+	if err == nil {
+		resp.Body = &countingReader{resp.Body, &m.BytesReceived}
+		defer resp.Body.Close()
 	}
-	if output != nil {
-		return json.NewDecoder(resp.Body).Decode(output)
+	if err == nil && resp.StatusCode < 300 {
+		res := &Response{StatusCode: resp.StatusCode, Header: resp.Header}
+		if r.Output != nil {
+			return res, 0, false, json.NewDecoder(resp.Body).Decode(r.Output)
+		}
+		return res, 0, false, nil
 	}
-	return nil
-}
 
-// ClientError describes what went wrong with a request that otherwise succeeded
-// but which resulted in an HTTP status code >= 300.
-type ClientError struct {
-	HTTPStatusCode int
-	Message        string
-}
+	if c.retry != nil && ctx.Err() == nil {
+		if wait, ok := c.retry.Retry(attempt, req, resp, err); ok {
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("route", r.Route),
+				slog.Int("attempt", attempt),
+				slog.Duration("wait", wait),
+			}
+			if resp != nil {
+				ioutil.ReadAll(resp.Body)
+				attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			} else {
+				attrs = append(attrs, slog.Any("error", err))
+			}
+			c.log(ctx, slog.LevelInfo, "nbiot: retrying request", attrs...)
+			return nil, wait, true, nil
+		}
+	}
 
-func newClientError(resp *http.Response) ClientError {
-	buf, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return ClientError{resp.StatusCode, err.Error()}
+		return nil, 0, false, &TransportError{Attempts: attempt, Err: err}
 	}
-	return ClientError{resp.StatusCode, string(buf)}
-}
-
-func (e ClientError) Error() string {
-	return fmt.Sprintf("%s: %s", http.StatusText(e.HTTPStatusCode), e.Message)
+	cerr := newClientError(resp)
+	cerr.Attempts = attempt
+	cerr.Method = r.Method
+	cerr.Path = r.Route
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header}, 0, false, cerr
 }
@@ -1,12 +1,24 @@
 package nbiot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
 )
 
 func TestMain(m *testing.M) {
+	if _, token, err := addressTokenFromConfig(ConfigFile); err == nil && token == "" {
+		// Without a configured API token the tests run against a fake API.
+		// The server isn't closed since the process exits right after.
+		srv := nbiottest.NewServer()
+		os.Setenv(AddressEnvironmentVariable, srv.URL)
+		os.Setenv(TokenEnvironmentVariable, srv.Token)
+	}
+
 	if _, err := New(); err != nil {
 		fmt.Println("Error creating client:", err)
 		fmt.Println("You might have to configure nbiot-go via a configuration file or environment variables")
@@ -44,3 +56,16 @@ func TestNewWithAddress(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestContextCanceled(t *testing.T) {
+	client, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.CollectionsContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package nbiot
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -23,56 +24,84 @@ type FieldMask struct {
 
 // Collection gets a collection.
 func (c *Client) Collection(id string) (Collection, error) {
+	return c.CollectionContext(context.Background(), id)
+}
+
+// CollectionContext gets a collection using the provided context.
+func (c *Client) CollectionContext(ctx context.Context, id string) (Collection, error) {
 	var collection Collection
-	err := c.get("/collections/"+id, &collection)
+	err := c.get(ctx, "/collections/"+id, &collection)
 	return collection, err
 }
 
 // Collections gets all collections that the user has access to.
 func (c *Client) Collections() ([]Collection, error) {
+	return c.CollectionsContext(context.Background())
+}
+
+// CollectionsContext gets all collections that the user has access to using
+// the provided context.
+func (c *Client) CollectionsContext(ctx context.Context) ([]Collection, error) {
 	var collections struct {
 		Collections []Collection `json:"collections"`
 	}
-	err := c.get("/collections", &collections)
+	err := c.get(ctx, "/collections", &collections)
 	return collections.Collections, err
 }
 
 // CreateCollection creates a collection.
 func (c *Client) CreateCollection(collection Collection) (Collection, error) {
-	err := c.create("/collections", &collection)
+	return c.CreateCollectionContext(context.Background(), collection)
+}
+
+// CreateCollectionContext creates a collection using the provided context.
+func (c *Client) CreateCollectionContext(ctx context.Context, collection Collection) (Collection, error) {
+	err := c.create(ctx, "/collections", &collection)
 	return collection, err
 }
 
 // UpdateCollection updates a collection.
 // No tags are deleted, only added or updated.
 func (c *Client) UpdateCollection(collection Collection) (Collection, error) {
-	err := c.update("/collections/"+collection.ID, &collection)
+	return c.UpdateCollectionContext(context.Background(), collection)
+}
+
+// UpdateCollectionContext updates a collection using the provided context.
+// No tags are deleted, only added or updated.
+func (c *Client) UpdateCollectionContext(ctx context.Context, collection Collection) (Collection, error) {
+	err := c.update(ctx, "/collections/"+collection.ID, &collection)
 	return collection, err
 }
 
 // DeleteCollectionTag deletes a tag from a collection.
 func (c *Client) DeleteCollectionTag(id, name string) error {
-	return c.delete(fmt.Sprintf("/collections/%s/tags/%s", id, name))
+	return c.DeleteCollectionTagContext(context.Background(), id, name)
+}
+
+// DeleteCollectionTagContext deletes a tag from a collection using the
+// provided context.
+func (c *Client) DeleteCollectionTagContext(ctx context.Context, id, name string) error {
+	return c.delete(ctx, fmt.Sprintf("/collections/%s/tags/%s", id, name))
 }
 
 // DeleteCollection deletes a collection.
 func (c *Client) DeleteCollection(id string) error {
-	return c.delete("/collections/" + id)
+	return c.DeleteCollectionContext(context.Background(), id)
+}
+
+// DeleteCollectionContext deletes a collection using the provided context.
+func (c *Client) DeleteCollectionContext(ctx context.Context, id string) error {
+	return c.delete(ctx, "/collections/"+id)
 }
 
 // CollectionData returns all the stored data for the collection.
+// It is a shorthand for QueryData.
 func (c *Client) CollectionData(collectionID string, since time.Time, until time.Time, limit int) ([]OutputDataMessage, error) {
-	var s, u int64
-	if !since.IsZero() {
-		s = since.UnixNano() / int64(time.Millisecond)
-	}
-	if !until.IsZero() {
-		u = until.UnixNano() / int64(time.Millisecond)
-	}
+	return c.CollectionDataContext(context.Background(), collectionID, since, until, limit)
+}
 
-	var data struct {
-		Messages []OutputDataMessage `json:"messages"`
-	}
-	err := c.get(fmt.Sprintf("/collections/%s/data?since=%d&until=%d&limit=%d", collectionID, s, u, limit), &data)
-	return data.Messages, err
+// CollectionDataContext returns all the stored data for the collection using
+// the provided context.
+func (c *Client) CollectionDataContext(ctx context.Context, collectionID string, since time.Time, until time.Time, limit int) ([]OutputDataMessage, error) {
+	return c.QueryDataContext(ctx, DataQuery{CollectionID: collectionID, Since: since, Until: until, Limit: limit})
 }
@@ -0,0 +1,184 @@
+package nbiot
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Decoder decodes message payloads into fields.
+type Decoder interface {
+	Decode(payload []byte) (map[string]interface{}, error)
+}
+
+// DecoderFunc is a function that implements Decoder.
+type DecoderFunc func(payload []byte) (map[string]interface{}, error)
+
+// Decode calls f(payload).
+func (f DecoderFunc) Decode(payload []byte) (map[string]interface{}, error) {
+	return f(payload)
+}
+
+// DecoderTag is the device tag that selects a decoder by name, e.g.
+// "decoder=cayenne-lpp".
+const DecoderTag = "decoder"
+
+// These are the built-in decoders. A DecoderRegistry has them registered
+// under the names "cayenne-lpp", "json" and "hex". CBOR and MessagePack
+// decoders are in the nbiotcodec package.
+var (
+	// CayenneLPPDecoder decodes Cayenne Low Power Payload. Fields are named
+	// after the data type and channel, e.g. "temperature_1".
+	CayenneLPPDecoder = DecoderFunc(decodeCayenneLPP)
+
+	// JSONDecoder decodes a JSON object.
+	JSONDecoder = DecoderFunc(decodeJSON)
+
+	// HexDecoder returns the payload as a hex string in the field "hex".
+	HexDecoder = DecoderFunc(decodeHex)
+)
+
+// DecoderRegistry selects a decoder for each message. Decoders are chosen by,
+// in order of precedence:
+//
+//  1. the device
+//  2. the DecoderTag of the device, naming a registered decoder
+//  3. the UDP port the message was sent to, or the CoAP path
+//  4. the collection of the device
+//
+// Messages without a decoder aren't decoded. The registry is safe for
+// concurrent use.
+type DecoderRegistry struct {
+	mu          sync.RWMutex
+	named       map[string]Decoder
+	devices     map[string]Decoder
+	collections map[string]Decoder
+	ports       map[int]Decoder
+	paths       map[string]Decoder
+}
+
+// NewDecoderRegistry returns a registry with the built-in decoders registered
+// by name.
+func NewDecoderRegistry() *DecoderRegistry {
+	r := &DecoderRegistry{
+		named:       make(map[string]Decoder),
+		devices:     make(map[string]Decoder),
+		collections: make(map[string]Decoder),
+		ports:       make(map[int]Decoder),
+		paths:       make(map[string]Decoder),
+	}
+	r.Register("cayenne-lpp", CayenneLPPDecoder)
+	r.Register("json", JSONDecoder)
+	r.Register("hex", HexDecoder)
+	return r
+}
+
+// Register registers a decoder by name, for use with DecoderTag.
+func (r *DecoderRegistry) Register(name string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.named[name] = d
+}
+
+// ForDevice sets the decoder for messages from a device.
+func (r *DecoderRegistry) ForDevice(deviceID string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.devices[deviceID] = d
+}
+
+// ForCollection sets the decoder for messages from a collection.
+func (r *DecoderRegistry) ForCollection(collectionID string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collections[collectionID] = d
+}
+
+// ForPort sets the decoder for UDP messages sent to a port.
+func (r *DecoderRegistry) ForPort(port int, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ports[port] = d
+}
+
+// ForPath sets the decoder for CoAP messages sent to a path.
+func (r *DecoderRegistry) ForPath(path string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paths[path] = d
+}
+
+// Lookup returns the decoder for a message, or nil if there is none.
+func (r *DecoderRegistry) Lookup(msg OutputDataMessage) Decoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if d, ok := r.devices[msg.Device.ID]; ok {
+		return d
+	}
+	if name, ok := msg.Device.Tags[DecoderTag]; ok {
+		if d, ok := r.named[name]; ok {
+			return d
+		}
+	}
+	switch msg.Transport {
+	case TransportUDP:
+		if d, ok := r.ports[msg.UDPMetaData.LocalPort]; ok {
+			return d
+		}
+	case TransportCoAP:
+		if d, ok := r.paths[msg.CoAPMetaData.Path]; ok {
+			return d
+		}
+	}
+	return r.collections[msg.Device.CollectionID]
+}
+
+// Decode decodes a message's payload with its decoder. It returns nil if the
+// message has no decoder.
+func (r *DecoderRegistry) Decode(msg OutputDataMessage) (map[string]interface{}, error) {
+	d := r.Lookup(msg)
+	if d == nil {
+		return nil, nil
+	}
+	return d.Decode(msg.Payload)
+}
+
+// WithDecoders makes the client decode the payloads of messages from output
+// streams and data queries, setting their Fields. Messages that can't be
+// decoded are logged and returned without fields.
+func WithDecoders(r *DecoderRegistry) Option {
+	return func(c *Client) {
+		c.decoders = r
+	}
+}
+
+// decode sets the fields of a message if the client has decoders.
+func (c *Client) decode(ctx context.Context, msg *OutputDataMessage) {
+	if c.decoders == nil {
+		return
+	}
+	fields, err := c.decoders.Decode(*msg)
+	if err != nil {
+		c.log(ctx, slog.LevelWarn, "nbiot: decoding payload failed",
+			slog.String("collectionId", msg.Device.CollectionID),
+			slog.String("deviceId", msg.Device.ID),
+			slog.Any("error", err))
+		return
+	}
+	msg.Fields = fields
+}
+
+func decodeJSON(payload []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("nbiot: decoding JSON payload: %v", err)
+	}
+	return fields, nil
+}
+
+func decodeHex(payload []byte) (map[string]interface{}, error) {
+	return map[string]interface{}{"hex": hex.EncodeToString(payload)}, nil
+}
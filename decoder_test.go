@@ -0,0 +1,132 @@
+package nbiot
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func TestBuiltinDecoders(t *testing.T) {
+	for name, test := range map[string]struct {
+		decoder Decoder
+		payload []byte
+		field   string
+		want    interface{}
+	}{
+		"json": {JSONDecoder, []byte(`{"name":"a"}`), "name", "a"},
+		"hex":  {HexDecoder, []byte{1, 0xab}, "hex", "01ab"},
+	} {
+		fields, err := test.decoder.Decode(test.payload)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if fields[test.field] != test.want {
+			t.Errorf("%s: got %v", name, fields)
+		}
+	}
+
+	if _, err := JSONDecoder.Decode([]byte{0xff, 0xff}); err == nil {
+		t.Error("json: expected error")
+	}
+}
+
+func TestDecoderRegistry(t *testing.T) {
+	r := NewDecoderRegistry()
+	collection := DecoderFunc(func([]byte) (map[string]interface{}, error) { return map[string]interface{}{"by": "collection"}, nil })
+	port := DecoderFunc(func([]byte) (map[string]interface{}, error) { return map[string]interface{}{"by": "port"}, nil })
+	path := DecoderFunc(func([]byte) (map[string]interface{}, error) { return map[string]interface{}{"by": "path"}, nil })
+	r.ForCollection("c", collection)
+	r.ForPort(1234, port)
+	r.ForPath("/a", path)
+
+	udp := OutputDataMessage{Device: Device{CollectionID: "c"}, Transport: TransportUDP, Payload: []byte{1}}
+	udp.UDPMetaData.LocalPort = 1234
+	coap := OutputDataMessage{Device: Device{CollectionID: "c"}, Transport: TransportCoAP}
+	coap.CoAPMetaData.Path = "/a"
+	tagged := udp
+	tagged.Device.Tags = map[string]string{DecoderTag: "hex"}
+	other := OutputDataMessage{Device: Device{CollectionID: "c"}, Transport: TransportUDP}
+	device := tagged
+	device.Device.ID = "d"
+	r.ForDevice("d", DecoderFunc(func([]byte) (map[string]interface{}, error) { return map[string]interface{}{"by": "device"}, nil }))
+
+	for name, test := range map[string]struct {
+		msg   OutputDataMessage
+		field string
+		want  interface{}
+	}{
+		"device":     {device, "by", "device"},
+		"tag":        {tagged, "hex", "01"},
+		"port":       {udp, "by", "port"},
+		"path":       {coap, "by", "path"},
+		"collection": {other, "by", "collection"},
+	} {
+		fields, err := r.Decode(test.msg)
+		if err != nil || fields[test.field] != test.want {
+			t.Errorf("%s: got %v, %v", name, fields, err)
+		}
+	}
+
+	if d := r.Lookup(OutputDataMessage{Device: Device{CollectionID: "other"}}); d != nil {
+		t.Error("expected no decoder")
+	}
+}
+
+func TestWithDecoders(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	r := NewDecoderRegistry()
+	client, err := NewWithOptions(srv.URL, srv.Token,
+		WithDecoders(r),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ForCollection(collection.ID, JSONDecoder)
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.DeviceOutputStream(collection.ID, device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	for i, payload := range []string{`{"temp":21.5}`, `not json`} {
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(payload), Received: time.Unix(1500000000+int64(i), 0)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Fields["temp"] != 21.5 {
+		t.Fatal("unexpected fields:", msg.Fields)
+	}
+	if msg, err = stream.Recv(); err != nil || msg.Fields != nil {
+		t.Fatal(err, msg.Fields)
+	}
+	if !strings.Contains(logs.String(), "decoding payload failed") {
+		t.Fatal("decode error not logged:", logs.String())
+	}
+
+	data, err := client.QueryData(DataQuery{CollectionID: collection.ID, Order: OldestFirst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data[0].Fields["temp"] != 21.5 {
+		t.Fatal("unexpected data:", data)
+	}
+}
@@ -1,6 +1,7 @@
 package nbiot
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -16,56 +17,82 @@ type Device struct {
 
 // Device gets a device.
 func (c *Client) Device(collectionID, deviceID string) (Device, error) {
+	return c.DeviceContext(context.Background(), collectionID, deviceID)
+}
+
+// DeviceContext gets a device using the provided context.
+func (c *Client) DeviceContext(ctx context.Context, collectionID, deviceID string) (Device, error) {
 	var device Device
-	err := c.get(fmt.Sprintf("/collections/%s/devices/%s", collectionID, deviceID), &device)
+	err := c.get(ctx, fmt.Sprintf("/collections/%s/devices/%s", collectionID, deviceID), &device)
 	return device, err
 }
 
 // Devices gets all devices in the collection.
 func (c *Client) Devices(collectionID string) ([]Device, error) {
+	return c.DevicesContext(context.Background(), collectionID)
+}
+
+// DevicesContext gets all devices in the collection using the provided context.
+func (c *Client) DevicesContext(ctx context.Context, collectionID string) ([]Device, error) {
 	var devices struct {
 		Devices []Device `json:"devices"`
 	}
-	err := c.get(fmt.Sprintf("/collections/%s/devices", collectionID), &devices)
+	err := c.get(ctx, fmt.Sprintf("/collections/%s/devices", collectionID), &devices)
 	return devices.Devices, err
 }
 
 // CreateDevice creates a device.
 func (c *Client) CreateDevice(collectionID string, device Device) (Device, error) {
-	err := c.create(fmt.Sprintf("/collections/%s/devices", collectionID), &device)
+	return c.CreateDeviceContext(context.Background(), collectionID, device)
+}
+
+// CreateDeviceContext creates a device using the provided context.
+func (c *Client) CreateDeviceContext(ctx context.Context, collectionID string, device Device) (Device, error) {
+	err := c.create(ctx, fmt.Sprintf("/collections/%s/devices", collectionID), &device)
 	return device, err
 }
 
 // UpdateDevice updates a device.
 // No tags are deleted, only added or updated.
 func (c *Client) UpdateDevice(collectionID string, device Device) (Device, error) {
-	err := c.update(fmt.Sprintf("/collections/%s/devices/%s", collectionID, device.ID), &device)
+	return c.UpdateDeviceContext(context.Background(), collectionID, device)
+}
+
+// UpdateDeviceContext updates a device using the provided context.
+// No tags are deleted, only added or updated.
+func (c *Client) UpdateDeviceContext(ctx context.Context, collectionID string, device Device) (Device, error) {
+	err := c.update(ctx, fmt.Sprintf("/collections/%s/devices/%s", collectionID, device.ID), &device)
 	return device, err
 }
 
 // DeleteDeviceTag deletes a tag from a device.
 func (c *Client) DeleteDeviceTag(collectionID, deviceID, name string) error {
-	return c.delete(fmt.Sprintf("/collections/%s/devices/%s/tags/%s", collectionID, deviceID, name))
+	return c.DeleteDeviceTagContext(context.Background(), collectionID, deviceID, name)
+}
+
+// DeleteDeviceTagContext deletes a tag from a device using the provided context.
+func (c *Client) DeleteDeviceTagContext(ctx context.Context, collectionID, deviceID, name string) error {
+	return c.delete(ctx, fmt.Sprintf("/collections/%s/devices/%s/tags/%s", collectionID, deviceID, name))
 }
 
 // DeleteDevice deletes a device.
 func (c *Client) DeleteDevice(collectionID, deviceID string) error {
-	return c.delete(fmt.Sprintf("/collections/%s/devices/%s", collectionID, deviceID))
+	return c.DeleteDeviceContext(context.Background(), collectionID, deviceID)
+}
+
+// DeleteDeviceContext deletes a device using the provided context.
+func (c *Client) DeleteDeviceContext(ctx context.Context, collectionID, deviceID string) error {
+	return c.delete(ctx, fmt.Sprintf("/collections/%s/devices/%s", collectionID, deviceID))
 }
 
 // DeviceData returns all the stored data for the device.
+// It is a shorthand for QueryData.
 func (c *Client) DeviceData(collectionID, deviceID string, since time.Time, until time.Time, limit int) ([]OutputDataMessage, error) {
-	var s, u int64
-	if !since.IsZero() {
-		s = since.UnixNano() / int64(time.Millisecond)
-	}
-	if !until.IsZero() {
-		u = until.UnixNano() / int64(time.Millisecond)
-	}
+	return c.DeviceDataContext(context.Background(), collectionID, deviceID, since, until, limit)
+}
 
-	var data struct {
-		Messages []OutputDataMessage `json:"messages"`
-	}
-	err := c.get(fmt.Sprintf("/collections/%s/devices/%s/data?since=%d&until=%d&limit=%d", collectionID, deviceID, s, u, limit), &data)
-	return data.Messages, err
+// DeviceDataContext returns all the stored data for the device using the
+// provided context.
+func (c *Client) DeviceDataContext(ctx context.Context, collectionID, deviceID string, since time.Time, until time.Time, limit int) ([]OutputDataMessage, error) {
+	return c.QueryDataContext(ctx, DataQuery{CollectionID: collectionID, DeviceID: deviceID, Since: since, Until: until, Limit: limit})
 }
@@ -0,0 +1,110 @@
+package nbiot
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithProxy makes the client connect through the proxy returned by proxy, for
+// both REST requests and output streams. Without it the client uses the proxy
+// of its HTTP transport, which for the default transport is taken from the
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+//
+// REST requests only use the proxy if the HTTP client's transport is an
+// *http.Transport, or the default.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *Client) {
+		c.proxy = proxy
+	}
+}
+
+// WithTLSConfig sets the TLS configuration, e.g. with custom root CAs or
+// client certificates, for both REST requests and output streams. As for
+// WithProxy, REST requests only use it if the HTTP client's transport is an
+// *http.Transport, or the default.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithStreamDialer sets the dialer for output streams, e.g. to set the
+// handshake timeout, buffer sizes or compression. Its Proxy, TLSClientConfig
+// and NetDialContext default to those of the client, so set Proxy to a
+// function returning nil to connect without a proxy. The dialer is copied.
+func WithStreamDialer(d *websocket.Dialer) Option {
+	return func(c *Client) {
+		dialer := *d
+		c.dialer = &dialer
+	}
+}
+
+// httpTransport returns the client's HTTP transport, or nil if it isn't an
+// *http.Transport.
+func (c *Client) httpTransport() *http.Transport {
+	if c.client.Transport == nil {
+		t, _ := http.DefaultTransport.(*http.Transport)
+		return t
+	}
+	t, _ := c.client.Transport.(*http.Transport)
+	return t
+}
+
+// applyTransportOptions applies WithProxy and WithTLSConfig to a copy of the
+// HTTP client's transport.
+func (c *Client) applyTransportOptions() {
+	if c.proxy == nil && c.tlsConfig == nil {
+		return
+	}
+	t := c.httpTransport()
+	if t == nil {
+		return
+	}
+	t = t.Clone()
+	if c.proxy != nil {
+		t.Proxy = c.proxy
+	}
+	if c.tlsConfig != nil {
+		t.TLSClientConfig = c.tlsConfig
+	}
+	hc := *c.client
+	hc.Transport = t
+	c.client = &hc
+}
+
+// streamDialer returns the dialer for output streams, sharing the proxy, TLS
+// configuration and dial function of the client's HTTP transport.
+func (c *Client) streamDialer() *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	if c.dialer != nil {
+		d = *c.dialer
+	}
+	t := c.httpTransport()
+	proxy, tlsConfig := c.proxy, c.tlsConfig
+	if t != nil {
+		if proxy == nil {
+			proxy = t.Proxy
+		}
+		if tlsConfig == nil {
+			tlsConfig = t.TLSClientConfig
+		}
+		if d.NetDialContext == nil && d.NetDial == nil {
+			d.NetDialContext = t.DialContext
+		}
+	} else if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	if c.dialer == nil || d.Proxy == nil {
+		d.Proxy = proxy
+	}
+	if d.TLSClientConfig == nil && tlsConfig != nil {
+		// The handshake needs HTTP/1.1, so don't offer HTTP/2 as a
+		// transport configured for it would.
+		d.TLSClientConfig = tlsConfig.Clone()
+		d.TLSClientConfig.NextProtos = nil
+	}
+	return &d
+}
@@ -0,0 +1,142 @@
+package nbiot
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+// connectProxy is an HTTP proxy that only supports CONNECT, as used for
+// websockets.
+type connectProxy struct {
+	tunnels atomic.Int32
+}
+
+func (p *connectProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+		return
+	}
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	p.tunnels.Add(1)
+	w.WriteHeader(http.StatusOK)
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	go func() {
+		io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
+
+func TestStreamProxy(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+	proxy := &connectProxy{}
+	proxySrv := httptest.NewServer(proxy)
+	defer proxySrv.Close()
+	proxyURL, _ := url.Parse(proxySrv.URL)
+
+	// The proxy of a stream dialer is only used by streams.
+	client, err := NewWithOptions(srv.URL, srv.Token, WithStreamDialer(&websocket.Dialer{
+		Proxy: http.ProxyURL(proxyURL),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy.tunnels.Load() != 0 {
+		t.Fatal("REST request went through the proxy")
+	}
+	stream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if proxy.tunnels.Load() != 1 {
+		t.Fatal("stream didn't go through the proxy")
+	}
+
+	// WithProxy applies to both.
+	client, err = NewWithOptions(srv.URL, srv.Token, WithProxy(http.ProxyURL(proxyURL)), WithoutPing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err = client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if proxy.tunnels.Load() != 2 {
+		t.Fatal("stream didn't go through the proxy")
+	}
+	if client.httpTransport().Proxy == nil {
+		t.Fatal("REST requests don't use the proxy")
+	}
+}
+
+func TestStreamTLS(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+	backend, _ := url.Parse(srv.URL)
+	tlsSrv := httptest.NewTLSServer(httputil.NewSingleHostReverseProxy(backend))
+	defer tlsSrv.Close()
+
+	if _, err := NewWithAddr(tlsSrv.URL, srv.Token); err == nil {
+		t.Fatal("expected an error for an unknown certificate authority")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsSrv.Certificate())
+	client, err := NewWithOptions(tlsSrv.URL, srv.Token, WithTLSConfig(&tls.Config{RootCAs: roots}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+}
+
+func TestStreamDialer(t *testing.T) {
+	client, err := NewWithOptions("http://localhost", "token", WithoutPing(), WithStreamDialer(&websocket.Dialer{
+		EnableCompression: true,
+		ReadBufferSize:    1 << 16,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := client.streamDialer()
+	if !d.EnableCompression || d.ReadBufferSize != 1<<16 {
+		t.Fatalf("dialer settings not kept: %+v", d)
+	}
+	if d.Proxy == nil || d.NetDialContext == nil {
+		t.Fatal("dialer doesn't share the transport's proxy and dial function")
+	}
+}
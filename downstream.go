@@ -1,6 +1,7 @@
 package nbiot
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
@@ -15,12 +16,23 @@ type DownstreamMessage struct {
 
 // Send sends a message to a device.
 func (c *Client) Send(collectionID, deviceID string, msg DownstreamMessage) error {
-	return c.request(http.MethodPost, fmt.Sprintf("/collections/%s/devices/%s/to", collectionID, deviceID), msg, nil)
+	return c.SendContext(context.Background(), collectionID, deviceID, msg)
+}
+
+// SendContext sends a message to a device using the provided context.
+func (c *Client) SendContext(ctx context.Context, collectionID, deviceID string, msg DownstreamMessage) error {
+	return c.request(ctx, http.MethodPost, fmt.Sprintf("/collections/%s/devices/%s/to", collectionID, deviceID), msg, nil)
 }
 
 // Broadcast sends a message to all devices in a collection.
-func (c *Client) Broadcast(collectionID string, msg DownstreamMessage) (result BroadcastResult, err error) {
-	err = c.request(http.MethodPost, fmt.Sprintf("/collections/%s/to", collectionID), msg, &result)
+func (c *Client) Broadcast(collectionID string, msg DownstreamMessage) (BroadcastResult, error) {
+	return c.BroadcastContext(context.Background(), collectionID, msg)
+}
+
+// BroadcastContext sends a message to all devices in a collection using the
+// provided context.
+func (c *Client) BroadcastContext(ctx context.Context, collectionID string, msg DownstreamMessage) (result BroadcastResult, err error) {
+	err = c.request(ctx, http.MethodPost, fmt.Sprintf("/collections/%s/to", collectionID), msg, &result)
 	return result, err
 }
 
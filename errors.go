@@ -0,0 +1,169 @@
+package nbiot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// These errors can be matched with errors.Is against errors returned by the
+// client, e.g.
+//
+//	if errors.Is(err, nbiot.ErrNotFound) {
+//	    ...
+//	}
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// statusError returns the sentinel error matching an HTTP status code, or nil
+// if there is none.
+func statusError(code int) error {
+	switch {
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case code == http.StatusForbidden:
+		return ErrForbidden
+	case code == http.StatusConflict:
+		return ErrConflict
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+// requestIDHeader is the response header holding the server's request ID.
+const requestIDHeader = "X-Request-Id"
+
+// ClientError describes what went wrong with a request that otherwise succeeded
+// but which resulted in an HTTP status code >= 300.
+type ClientError struct {
+	HTTPStatusCode int
+	Message        string       // The raw response body
+	Detail         *ErrorDetail // The parsed response body, if it was JSON
+	Method         string       // The HTTP method of the request
+	Path           string       // The route template of the request, e.g. /collections/{id}
+	RequestID      string       // The request ID reported by the server, if any
+	Attempts       int          // The number of attempts made, including retries
+}
+
+// ErrorDetail is the JSON error body returned by the API.
+type ErrorDetail struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func newClientError(resp *http.Response) ClientError {
+	e := ClientError{
+		HTTPStatusCode: resp.StatusCode,
+		RequestID:      resp.Header.Get(requestIDHeader),
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		e.Message = err.Error()
+		return e
+	}
+	e.Message = string(buf)
+
+	var detail ErrorDetail
+	if json.Unmarshal(buf, &detail) == nil && (detail != ErrorDetail{}) {
+		e.Detail = &detail
+	}
+	return e
+}
+
+func (e ClientError) Error() string {
+	msg := e.Message
+	if e.Detail != nil && e.Detail.Message != "" {
+		msg = e.Detail.Message
+	}
+	if e.Method != "" {
+		return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, http.StatusText(e.HTTPStatusCode), msg)
+	}
+	return fmt.Sprintf("%s: %s", http.StatusText(e.HTTPStatusCode), msg)
+}
+
+// Is reports whether the error matches target, which is one of the ErrNotFound,
+// ErrUnauthorized, ErrForbidden, ErrConflict, ErrRateLimited or ErrServer
+// sentinels.
+func (e ClientError) Is(target error) bool {
+	return target != nil && target == statusError(e.HTTPStatusCode)
+}
+
+// StreamError describes a failed websocket handshake for an output stream.
+// It matches the same sentinels as ClientError, so that e.g. a deleted
+// collection (ErrNotFound) can be told from a revoked token (ErrUnauthorized).
+type StreamError struct {
+	URL        string // The websocket URL, without the token
+	StatusCode int    // The HTTP status of the handshake response, or 0 if there was none
+	Body       string // The response body, if any
+	Err        error  // The error from the dialer
+}
+
+func (e *StreamError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("nbiot: output stream %s: %v", e.URL, e.Err)
+	}
+	msg := http.StatusText(e.StatusCode)
+	if body := strings.TrimSpace(e.Body); body != "" {
+		msg += ": " + body
+	}
+	return fmt.Sprintf("nbiot: output stream %s: %s", e.URL, msg)
+}
+
+// Unwrap returns the underlying error.
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error matches target, which is one of the ErrNotFound,
+// ErrUnauthorized, ErrForbidden, ErrConflict, ErrRateLimited or ErrServer
+// sentinels.
+func (e *StreamError) Is(target error) bool {
+	return target != nil && target == statusError(e.StatusCode)
+}
+
+// TransportError describes a request that failed without an HTTP response,
+// e.g. because the connection was reset or the context was cancelled.
+type TransportError struct {
+	Attempts int // The number of attempts made, including retries
+	Err      error
+}
+
+func (e *TransportError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("%v (after %d attempts)", e.Err, e.Attempts)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Attempts returns the number of attempts made for the request that resulted
+// in err, or 0 if err does not come from a request.
+func Attempts(err error) int {
+	var cerr ClientError
+	if errors.As(err, &cerr) {
+		return cerr.Attempts
+	}
+	var terr *TransportError
+	if errors.As(err, &terr) {
+		return terr.Attempts
+	}
+	return 0
+}
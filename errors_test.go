@@ -0,0 +1,100 @@
+package nbiot
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func TestClientErrorIs(t *testing.T) {
+	for code, target := range map[int]error{
+		http.StatusNotFound:            ErrNotFound,
+		http.StatusUnauthorized:        ErrUnauthorized,
+		http.StatusForbidden:           ErrForbidden,
+		http.StatusConflict:            ErrConflict,
+		http.StatusTooManyRequests:     ErrRateLimited,
+		http.StatusInternalServerError: ErrServer,
+		http.StatusBadGateway:          ErrServer,
+	} {
+		err := error(ClientError{HTTPStatusCode: code})
+		if !errors.Is(err, target) {
+			t.Errorf("%d is not %v", code, target)
+		}
+		if errors.Is(err, ErrConflict) != (target == ErrConflict) {
+			t.Errorf("%d should not be %v", code, ErrConflict)
+		}
+	}
+	if errors.Is(ClientError{HTTPStatusCode: http.StatusBadRequest}, ErrServer) {
+		t.Error("400 should not match any sentinel")
+	}
+}
+
+func TestClientErrorDetails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-1")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"status":404,"message":"Device not found"}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewWithOptions(srv.URL, "token", WithoutPing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Device("1", "2")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+	var cerr ClientError
+	if !errors.As(err, &cerr) {
+		t.Fatal("expected ClientError, got", err)
+	}
+	if cerr.Method != http.MethodGet || cerr.Path != "/collections/{id}/devices/{id}" || cerr.RequestID != "req-1" {
+		t.Fatalf("unexpected error: %#v", cerr)
+	}
+	if cerr.Detail == nil || cerr.Detail.Message != "Device not found" {
+		t.Fatalf("unexpected detail: %#v", cerr.Detail)
+	}
+	if err.Error() != "GET /collections/{id}/devices/{id}: Not Found: Device not found" {
+		t.Fatal("unexpected message:", err)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.CollectionOutputStream("missing")
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnauthorized) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+	var serr *StreamError
+	if !errors.As(err, &serr) {
+		t.Fatal("expected StreamError, got", err)
+	}
+	if serr.StatusCode != http.StatusNotFound || !strings.Contains(serr.Body, "Collection not found") ||
+		!strings.HasSuffix(serr.URL, "/collections/missing/from") || strings.Contains(serr.URL, srv.Token) {
+		t.Fatalf("unexpected error: %#v", serr)
+	}
+
+	client, _ = NewWithOptions(srv.URL, "revoked", WithoutPing())
+	if _, err := client.CollectionOutputStream("missing"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatal("expected ErrUnauthorized, got", err)
+	}
+
+	// Without a response there is no status.
+	srv.Close()
+	client, _ = NewWithOptions(srv.URL, srv.Token, WithoutPing())
+	_, err = client.CollectionOutputStream("missing")
+	if !errors.As(err, &serr) || serr.StatusCode != 0 || serr.Err == nil {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+}
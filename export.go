@@ -0,0 +1,209 @@
+package nbiot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// These are the defaults of ExportOptions.
+const (
+	defaultExportWindow      = 24 * time.Hour
+	defaultExportConcurrency = 4
+	defaultExportPageSize    = 1000
+)
+
+// ExportOptions are the options of an export.
+type ExportOptions struct {
+	Since time.Time // The earliest time to include; required unless resuming
+	Until time.Time // The latest time to include; now if zero
+
+	// Window is the length of the time windows fetched concurrently. Windows
+	// holding more than PageSize messages are split further. The default is
+	// 24 hours.
+	Window time.Duration
+
+	Concurrency int // The maximum number of concurrent requests; 4 if zero
+	PageSize    int // The number of messages fetched per request; 1000 if zero, at most 1000
+
+	// Checkpoint, if set, resumes an earlier export. It overrides Since and
+	// Until.
+	Checkpoint *ExportCheckpoint
+
+	// Progress, if set, is called after each window has been emitted.
+	Progress func(ExportProgress)
+}
+
+// ExportCheckpoint is the state of an export after a window has been emitted.
+// It can be serialized as JSON and passed in ExportOptions to resume the
+// export.
+type ExportCheckpoint struct {
+	Since time.Time `json:"since"` // The start of the remaining time range
+	Until time.Time `json:"until"` // The end of the remaining time range
+}
+
+// ExportProgress reports the progress of an export.
+type ExportProgress struct {
+	Windows     int // The number of windows in the export
+	WindowsDone int // The number of windows emitted
+	Messages    int // The number of messages emitted
+	Checkpoint  ExportCheckpoint
+}
+
+// ExportCollectionData calls fn with all the stored data for the collection
+// in the time range, oldest first. See ExportCollectionDataContext.
+func (c *Client) ExportCollectionData(collectionID string, opts ExportOptions, fn func(OutputDataMessage) error) error {
+	return c.ExportCollectionDataContext(context.Background(), collectionID, opts, fn)
+}
+
+// ExportCollectionDataContext calls fn with all the stored data for the
+// collection in the time range, oldest first, using the provided context.
+//
+// The time range is split into windows that are fetched concurrently, but fn
+// is called from a single goroutine in order. Since the windows don't overlap
+// each message is emitted once. If fn returns an error the export stops and
+// the error is returned.
+func (c *Client) ExportCollectionDataContext(ctx context.Context, collectionID string, opts ExportOptions, fn func(OutputDataMessage) error) error {
+	return c.export(ctx, DataQuery{CollectionID: collectionID}.path(), opts, fn)
+}
+
+// ExportDeviceData calls fn with all the stored data for the device in the
+// time range, oldest first. See ExportCollectionDataContext.
+func (c *Client) ExportDeviceData(collectionID, deviceID string, opts ExportOptions, fn func(OutputDataMessage) error) error {
+	return c.ExportDeviceDataContext(context.Background(), collectionID, deviceID, opts, fn)
+}
+
+// ExportDeviceDataContext calls fn with all the stored data for the device in
+// the time range, oldest first, using the provided context. See
+// ExportCollectionDataContext.
+func (c *Client) ExportDeviceDataContext(ctx context.Context, collectionID, deviceID string, opts ExportOptions, fn func(OutputDataMessage) error) error {
+	return c.export(ctx, DataQuery{CollectionID: collectionID, DeviceID: deviceID}.path(), opts, fn)
+}
+
+// exportWindow is a time window of an export, in milliseconds.
+type exportWindow struct {
+	since, until int64
+	messages     []OutputDataMessage // Newest first
+	err          error
+	done         chan struct{}
+}
+
+func (c *Client) export(ctx context.Context, path string, opts ExportOptions, fn func(OutputDataMessage) error) error {
+	since, until := opts.Since, opts.Until
+	if opts.Checkpoint != nil {
+		since, until = opts.Checkpoint.Since, opts.Checkpoint.Until
+	}
+	if since.IsZero() {
+		return errors.New("nbiot: export without a start time")
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+	window := opts.Window
+	if window <= 0 {
+		window = defaultExportWindow
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultExportConcurrency
+	}
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultExportPageSize
+	}
+	pageSize = min(pageSize, maxDataLimit)
+
+	s, u := millis(since), millis(until)
+	step := int64(window / time.Millisecond)
+	if step < 1 {
+		step = 1
+	}
+	progress := ExportProgress{Checkpoint: ExportCheckpoint{Since: since, Until: until}}
+	if s <= u {
+		progress.Windows = int((u - s + step) / step)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The windows are queued in order as they are started, and the number
+	// of windows started but not emitted is bounded by the concurrency.
+	queue := make(chan *exportWindow, concurrency-1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(queue)
+		for start := s; start <= u; start += step {
+			w := &exportWindow{since: start, until: start + step - 1, done: make(chan struct{})}
+			if w.until > u {
+				w.until = u
+			}
+			select {
+			case queue <- w:
+			case <-ctx.Done():
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer close(w.done)
+				w.messages, w.err = c.fetchWindow(ctx, path, w.since, w.until, pageSize)
+			}()
+		}
+	}()
+
+	for w := range queue {
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if w.err != nil {
+			return w.err
+		}
+		for i := len(w.messages) - 1; i >= 0; i-- {
+			if err := fn(w.messages[i]); err != nil {
+				return err
+			}
+		}
+
+		progress.WindowsDone++
+		progress.Messages += len(w.messages)
+		progress.Checkpoint.Since = time.Unix(0, (w.until+1)*int64(time.Millisecond))
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+	return ctx.Err()
+}
+
+// fetchWindow fetches all messages in a time window, newest first, splitting
+// the window in two if it holds more than a page. limit must not exceed the
+// API's maximum, or a capped page would be taken for the whole window.
+func (c *Client) fetchWindow(ctx context.Context, path string, since, until int64, limit int) ([]OutputDataMessage, error) {
+	page, err := c.data(ctx, path, since, until, limit)
+	if err != nil || len(page) < limit {
+		return page, err
+	}
+	if since == until {
+		// A single millisecond can't be split.
+		if limit >= maxDataLimit {
+			return nil, tooManyMessages(since)
+		}
+		return c.fetchWindow(ctx, path, since, until, min(2*limit, maxDataLimit))
+	}
+
+	mid := since + (until-since)/2
+	newer, err := c.fetchWindow(ctx, path, mid+1, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	older, err := c.fetchWindow(ctx, path, since, mid, limit)
+	if err != nil {
+		return nil, err
+	}
+	return append(newer, older...), nil
+}
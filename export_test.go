@@ -0,0 +1,170 @@
+package nbiot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func TestExport(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 100 messages over 10 seconds, with a burst in one millisecond that
+	// exceeds the page size.
+	start := time.Unix(1500000000, 0)
+	for i := 0; i < 100; i++ {
+		received := start.Add(time.Duration(i) * 100 * time.Millisecond)
+		if i >= 40 && i < 50 {
+			received = start.Add(4 * time.Second)
+		}
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(fmt.Sprint(i)), Received: received}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := ExportOptions{
+		Since:       start,
+		Until:       start.Add(10 * time.Second),
+		Window:      time.Second,
+		Concurrency: 3,
+		PageSize:    4,
+	}
+	var got []OutputDataMessage
+	var progress []ExportProgress
+	opts.Progress = func(p ExportProgress) { progress = append(progress, p) }
+	err = client.ExportCollectionData(collection.ID, opts, func(msg OutputDataMessage) error {
+		got = append(got, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 100 {
+		t.Fatalf("got %d messages, want 100", len(got))
+	}
+	seen := make(map[string]bool)
+	for i, msg := range got {
+		if i > 0 && msg.Received < got[i-1].Received {
+			t.Fatalf("message %d out of order", i)
+		}
+		if seen[string(msg.Payload)] {
+			t.Fatalf("message %s emitted twice", msg.Payload)
+		}
+		seen[string(msg.Payload)] = true
+	}
+	if len(progress) != 11 || progress[10].WindowsDone != 11 || progress[10].Messages != 100 {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+
+	// Stop after the fifth window and resume from the last checkpoint.
+	stop := errors.New("stop")
+	var checkpoint []byte
+	opts.Progress = func(p ExportProgress) {
+		if checkpoint, err = json.Marshal(p.Checkpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := 0
+	err = client.ExportDeviceData(collection.ID, device.ID, opts, func(msg OutputDataMessage) error {
+		if msg.Received >= millis(start.Add(5*time.Second)) {
+			return stop
+		}
+		n++
+		return nil
+	})
+	if err != stop {
+		t.Fatal("expected the error from the callback, got", err)
+	}
+
+	var cp ExportCheckpoint
+	if err := json.Unmarshal(checkpoint, &cp); err != nil {
+		t.Fatal(err)
+	}
+	opts.Checkpoint = &cp
+	err = client.ExportDeviceData(collection.ID, device.ID, opts, func(msg OutputDataMessage) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("got %d messages after resuming, want 100", n)
+	}
+
+	if err := client.ExportDeviceData(collection.ID, device.ID, ExportOptions{}, nil); err == nil {
+		t.Fatal("expected error without a start time")
+	}
+}
+
+func TestExportPageCap(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single window with more messages than the API returns at once,
+	// fetched with a larger page size than it allows.
+	start := time.Unix(1500000000, 0)
+	for i := 0; i < maxDataLimit+200; i++ {
+		received := start.Add(time.Duration(i) * time.Millisecond)
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(fmt.Sprint(i)), Received: received}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := ExportOptions{Since: start, Until: start.Add(time.Hour), Window: time.Hour, PageSize: 5000}
+	n := 0
+	err = client.ExportDeviceData(collection.ID, device.ID, opts, func(OutputDataMessage) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != maxDataLimit+200 {
+		t.Fatalf("got %d messages, want %d", n, maxDataLimit+200)
+	}
+
+	// A millisecond with more messages than the API returns at once fails
+	// the export rather than losing messages.
+	for i := 0; i <= maxDataLimit; i++ {
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte("same"), Received: start.Add(-time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts.Since = start.Add(-time.Minute)
+	err = client.ExportDeviceData(collection.ID, device.ID, opts, func(OutputDataMessage) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "more than 1000 messages") {
+		t.Fatal("expected an error, got", err)
+	}
+}
@@ -0,0 +1,36 @@
+// Package redact removes secrets from API bodies, for logs and recorded
+// cassettes.
+package redact
+
+// Placeholder replaces secrets.
+const Placeholder = "[REDACTED]"
+
+// secretConfigKeys are the output config fields that hold secrets.
+var secretConfigKeys = map[string]bool{
+	"basicAuthPass": true, // webhook
+	"password":      true, // MQTT
+	"key":           true, // IFTTT
+}
+
+// Config replaces the secrets in all output configs in v, which is a decoded
+// JSON value.
+func Config(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if config, ok := val.(map[string]interface{}); ok && k == "config" {
+				for ck, cv := range config {
+					if s, ok := cv.(string); ok && s != "" && secretConfigKeys[ck] {
+						config[ck] = Placeholder
+					}
+				}
+				continue
+			}
+			Config(val)
+		}
+	case []interface{}:
+		for _, val := range v {
+			Config(val)
+		}
+	}
+}
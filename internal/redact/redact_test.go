@@ -0,0 +1,17 @@
+package redact
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	var v interface{}
+	json.Unmarshal([]byte(`[{"type":"webhook","config":{"url":"u","basicAuthPass":"p","password":""}},{"key":"k"}]`), &v)
+	Config(v)
+	buf, _ := json.Marshal(v)
+	want := `[{"config":{"basicAuthPass":"[REDACTED]","password":"","url":"u"},"type":"webhook"},{"key":"k"}]`
+	if string(buf) != want {
+		t.Fatalf("got %s, want %s", buf, want)
+	}
+}
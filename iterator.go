@@ -0,0 +1,320 @@
+package nbiot
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+)
+
+// Order is the order in which stored messages are returned.
+type Order int
+
+// These are the orders of stored messages.
+const (
+	NewestFirst Order = iota // The order used by the API
+	OldestFirst
+)
+
+const (
+	// defaultPageSize is the page size of data iterators without one.
+	defaultPageSize = 100
+
+	// maxDataLimit is the most messages the API returns for a data query.
+	// Larger limits are capped by the API, which would make a full page look
+	// like the last one.
+	maxDataLimit = 1000
+)
+
+// dataEpoch is a time before any stored data, as NB-IoT was standardised in
+// 2016. Iterating oldest first without Since starts here rather than at the
+// Unix epoch.
+var dataEpoch = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// DataIteratorOptions are the options of a DataIterator.
+type DataIteratorOptions struct {
+	Since    time.Time // The earliest time to include, if not zero
+	Until    time.Time // The latest time to include, if not zero
+	PageSize int       // The number of messages fetched per request; 100 if zero, at most 1000
+	Order    Order
+}
+
+// DataIterator iterates over the stored data of a collection or device,
+// fetching as many pages as necessary. Messages are returned once even if
+// several of them share the same timestamp.
+//
+//	it := client.DeviceDataIterator(collectionID, deviceID, nbiot.DataIteratorOptions{})
+//	for it.Next() {
+//		msg := it.Message()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type DataIterator struct {
+	ctx      context.Context
+	client   *Client
+	path     string
+	pageSize int
+	order    Order
+
+	since, until int64 // The remaining window in milliseconds
+	width        int64 // The width of the next window when walking forward
+	limit        int
+	seen         map[messageKey]int // Messages at the edge of the window already returned
+	page         []OutputDataMessage
+	msg          OutputDataMessage
+	done         bool
+	err          error
+}
+
+// CollectionDataIterator returns an iterator over the stored data for the
+// collection.
+func (c *Client) CollectionDataIterator(collectionID string, opts DataIteratorOptions) *DataIterator {
+	return c.CollectionDataIteratorContext(context.Background(), collectionID, opts)
+}
+
+// CollectionDataIteratorContext returns an iterator over the stored data for
+// the collection using the provided context.
+func (c *Client) CollectionDataIteratorContext(ctx context.Context, collectionID string, opts DataIteratorOptions) *DataIterator {
+	return c.dataIterator(ctx, DataQuery{CollectionID: collectionID}.path(), opts)
+}
+
+// DeviceDataIterator returns an iterator over the stored data for the device.
+func (c *Client) DeviceDataIterator(collectionID, deviceID string, opts DataIteratorOptions) *DataIterator {
+	return c.DeviceDataIteratorContext(context.Background(), collectionID, deviceID, opts)
+}
+
+// DeviceDataIteratorContext returns an iterator over the stored data for the
+// device using the provided context.
+func (c *Client) DeviceDataIteratorContext(ctx context.Context, collectionID, deviceID string, opts DataIteratorOptions) *DataIterator {
+	return c.dataIterator(ctx, DataQuery{CollectionID: collectionID, DeviceID: deviceID}.path(), opts)
+}
+
+func (c *Client) dataIterator(ctx context.Context, path string, opts DataIteratorOptions) *DataIterator {
+	it := &DataIterator{
+		ctx:      ctx,
+		client:   c,
+		path:     path,
+		pageSize: opts.PageSize,
+		order:    opts.Order,
+		since:    millis(opts.Since),
+		until:    millis(opts.Until),
+		seen:     make(map[messageKey]int),
+	}
+	if it.pageSize <= 0 {
+		it.pageSize = defaultPageSize
+	}
+	it.pageSize = min(it.pageSize, maxDataLimit)
+	if it.order == OldestFirst {
+		// Walking forward needs bounds.
+		if it.until == 0 {
+			it.until = millis(time.Now())
+		}
+		if it.since == 0 {
+			it.since = millis(dataEpoch)
+		}
+	}
+	it.limit = it.pageSize
+	return it
+}
+
+// Next advances to the next message, which is then available through
+// Message. It returns false when there are no more messages or an error
+// occurred.
+func (it *DataIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		if it.order == OldestFirst {
+			it.err = it.fetchForward()
+		} else {
+			it.err = it.fetchBackward()
+		}
+	}
+	it.msg, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Message returns the current message.
+func (it *DataIterator) Message() OutputDataMessage {
+	return it.msg
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *DataIterator) Err() error {
+	return it.err
+}
+
+// All returns the remaining messages as an iterator. An error ends the
+// iteration and is yielded along with an empty message.
+func (it *DataIterator) All() iter.Seq2[OutputDataMessage, error] {
+	return func(yield func(OutputDataMessage, error) bool) {
+		for it.Next() {
+			if !yield(it.Message(), nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(OutputDataMessage{}, err)
+		}
+	}
+}
+
+// fetchBackward fetches the next page when walking from newest to oldest.
+// The next window ends at the oldest timestamp of the page, inclusive, since
+// the page may have been cut off in the middle of a millisecond. Messages at
+// that timestamp are remembered so that they are skipped the next time.
+func (it *DataIterator) fetchBackward() error {
+	page, err := it.client.data(it.ctx, it.path, it.since, it.until, it.limit)
+	if err != nil {
+		return err
+	}
+	full := len(page) >= it.limit
+	if full && page[0].Received == page[len(page)-1].Received {
+		// The whole page has the same timestamp, so moving the window
+		// wouldn't get any further. Ask for more at once instead.
+		return it.growLimit(page[0].Received)
+	}
+	it.limit = it.pageSize
+
+	for _, msg := range page {
+		k := keyOf(msg)
+		if it.seen[k] > 0 && msg.Received == it.until {
+			it.seen[k]--
+			continue
+		}
+		it.page = append(it.page, msg)
+	}
+	if !full {
+		it.done = true
+		return nil
+	}
+
+	oldest := page[len(page)-1].Received
+	it.seen = make(map[messageKey]int)
+	for _, msg := range page {
+		if msg.Received == oldest {
+			it.seen[keyOf(msg)]++
+		}
+	}
+	it.until = oldest
+	return nil
+}
+
+// fetchForward fetches the next page when walking from oldest to newest.
+// Since the API returns the newest messages of a window first, the window is
+// narrowed until it holds no more than a page, and widened again after.
+func (it *DataIterator) fetchForward() error {
+	if it.width <= 0 && it.since <= it.until {
+		// Estimate the width of a page from the newest page rather than
+		// halving the whole window many times.
+		page, err := it.client.data(it.ctx, it.path, it.since, it.until, it.limit)
+		if err != nil {
+			return err
+		}
+		if len(page) < it.limit {
+			for i := len(page) - 1; i >= 0; i-- {
+				it.page = append(it.page, page[i])
+			}
+			it.done = true
+			return nil
+		}
+		it.width = it.until - page[len(page)-1].Received + 1
+	}
+	for it.since <= it.until {
+		end := it.since + it.width - 1
+		if end > it.until || end < it.since {
+			end = it.until
+		}
+		page, err := it.client.data(it.ctx, it.path, it.since, end, it.limit)
+		if err != nil {
+			return err
+		}
+		if len(page) >= it.limit {
+			if end == it.since {
+				// A single millisecond can't be split.
+				if err := it.growLimit(end); err != nil {
+					return err
+				}
+			} else {
+				it.width = (end - it.since + 1) / 2
+			}
+			continue
+		}
+
+		it.limit = it.pageSize
+		it.since = end + 1
+		it.width *= 2
+		for i := len(page) - 1; i >= 0; i-- {
+			it.page = append(it.page, page[i])
+		}
+		if len(it.page) > 0 {
+			return nil
+		}
+	}
+	it.done = true
+	return nil
+}
+
+// growLimit doubles the limit to get all messages received in the
+// millisecond at received, up to the API's maximum.
+func (it *DataIterator) growLimit(received int64) error {
+	if it.limit >= maxDataLimit {
+		return tooManyMessages(received)
+	}
+	it.limit = min(2*it.limit, maxDataLimit)
+	return nil
+}
+
+// tooManyMessages is the error for a millisecond with more messages than the
+// API returns at once, which can't be fetched in full.
+func tooManyMessages(received int64) error {
+	return fmt.Errorf("nbiot: more than %d messages received at %s", maxDataLimit,
+		time.UnixMilli(received).UTC().Format(time.RFC3339Nano))
+}
+
+// data fetches stored data. since and until are in milliseconds, with zero
+// meaning no bound.
+func (c *Client) data(ctx context.Context, path string, since, until int64, limit int) ([]OutputDataMessage, error) {
+	var data struct {
+		Messages []OutputDataMessage `json:"messages"`
+	}
+	err := c.get(ctx, fmt.Sprintf("%s?since=%d&until=%d&limit=%d", path, since, until, limit), &data)
+	for i := range data.Messages {
+		c.decode(ctx, &data.Messages[i])
+	}
+	return data.Messages, err
+}
+
+// millis converts t to milliseconds since the epoch, or zero if t is zero.
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// messageKey identifies a stored message.
+type messageKey struct {
+	device     string
+	received   int64
+	transport  string
+	payload    string
+	localPort  int
+	remotePort int
+	coapPath   string
+}
+
+func keyOf(msg OutputDataMessage) messageKey {
+	return messageKey{
+		device:     msg.Device.ID,
+		received:   msg.Received,
+		transport:  string(msg.Transport),
+		payload:    string(msg.Payload),
+		localPort:  msg.UDPMetaData.LocalPort,
+		remotePort: msg.UDPMetaData.RemotePort,
+		coapPath:   msg.CoAPMetaData.Path,
+	}
+}
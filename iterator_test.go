@@ -0,0 +1,154 @@
+package nbiot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func TestDataIterator(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 30 messages, with runs of several messages in the same millisecond
+	// that cross page boundaries, and one run longer than a page.
+	start := time.Unix(1500000000, 0)
+	var want []string
+	for i := 0; i < 30; i++ {
+		received := start.Add(time.Duration(i/3) * time.Millisecond)
+		if i >= 20 {
+			received = start.Add(time.Second)
+		}
+		payload := fmt.Sprint(i)
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(payload), Received: received}); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, payload)
+	}
+
+	for _, order := range []Order{NewestFirst, OldestFirst} {
+		it := client.DeviceDataIterator(collection.ID, device.ID, DataIteratorOptions{PageSize: 4, Order: order})
+		var got []string
+		var last int64
+		for msg, err := range it.All() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) > 0 && ((order == NewestFirst && msg.Received > last) || (order == OldestFirst && msg.Received < last)) {
+				t.Fatalf("order %d: message %s out of order", order, msg.Payload)
+			}
+			last = msg.Received
+			got = append(got, string(msg.Payload))
+		}
+		if !samePayloads(got, want) {
+			t.Errorf("order %d: got %v, want %v", order, got, want)
+		}
+	}
+
+	it := client.CollectionDataIterator(collection.ID, DataIteratorOptions{
+		Since:    start.Add(time.Millisecond),
+		Until:    start.Add(2 * time.Millisecond),
+		PageSize: 2,
+	})
+	var got []string
+	for it.Next() {
+		got = append(got, string(it.Message().Payload))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !samePayloads(got, want[3:9]) {
+		t.Errorf("got %v, want %v", got, want[3:9])
+	}
+}
+
+func TestDataIteratorPageCap(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// More messages than the API returns at once, fetched with a larger
+	// page size than it allows.
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < maxDataLimit+200; i++ {
+		received := start.Add(time.Duration(i) * time.Millisecond)
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(fmt.Sprint(i)), Received: received}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, order := range []Order{NewestFirst, OldestFirst} {
+		n := 0
+		for _, err := range client.DeviceDataIterator(collection.ID, device.ID, DataIteratorOptions{PageSize: 5000, Order: order}).All() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			n++
+		}
+		if n != maxDataLimit+200 {
+			t.Errorf("order %d: got %d messages, want %d", order, n, maxDataLimit+200)
+		}
+	}
+
+	// A millisecond with more messages than the API returns at once can't
+	// be fetched in full.
+	for i := 0; i <= maxDataLimit; i++ {
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte("same"), Received: start.Add(-time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, order := range []Order{NewestFirst, OldestFirst} {
+		it := client.DeviceDataIterator(collection.ID, device.ID, DataIteratorOptions{Order: order})
+		for it.Next() {
+		}
+		if it.Err() == nil || !strings.Contains(it.Err().Error(), "more than 1000 messages") {
+			t.Errorf("order %d: expected an error, got %v", order, it.Err())
+		}
+	}
+}
+
+// samePayloads reports whether a and b hold the same payloads regardless of
+// order.
+func samePayloads(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, p := range a {
+		count[p]++
+	}
+	for _, p := range b {
+		if count[p] == 0 {
+			return false
+		}
+		count[p]--
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package nbiot
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// These are suitable keepalive settings for WithStreamKeepalive.
+const (
+	DefaultPingInterval = 30 * time.Second
+	DefaultPongTimeout  = 15 * time.Second
+)
+
+// ErrStreamTimeout is returned by output streams that have received nothing,
+// not even a pong, for the ping interval plus the pong timeout.
+var ErrStreamTimeout = errors.New("nbiot: output stream timed out")
+
+// WithStreamKeepalive makes output streams ping the server every interval,
+// and end with ErrStreamTimeout when nothing has been received for timeout
+// longer than that, so that dead connections are detected. Without it, or with
+// a zero interval, streams don't ping and wait for frames indefinitely.
+//
+//	nbiot.WithStreamKeepalive(nbiot.DefaultPingInterval, nbiot.DefaultPongTimeout)
+func WithStreamKeepalive(interval, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.pingInterval = interval
+		c.pongTimeout = timeout
+	}
+}
+
+// StreamFrame is a frame other than a data message received on an output
+// stream. It is a KeepaliveFrame, PongFrame or RawFrame.
+type StreamFrame interface {
+	streamFrame()
+}
+
+// KeepaliveFrame is a keepalive message sent by the server.
+type KeepaliveFrame struct{}
+
+// PongFrame is the answer to a ping sent by the client.
+type PongFrame struct {
+	RTT time.Duration // The round-trip time of the ping
+}
+
+// RawFrame is any other frame, e.g. a notice from the server.
+type RawFrame struct {
+	Type string          // The frame's "type" field
+	Data json.RawMessage // The whole frame
+}
+
+func (KeepaliveFrame) streamFrame() {}
+func (PongFrame) streamFrame()      {}
+func (RawFrame) streamFrame()       {}
+
+// WithFrameHandler makes the client call fn with the non-data frames received
+// on output streams, along with the path of the stream. fn is called from the
+// goroutine reading the stream, so it should return quickly and must not call
+// the stream's Close.
+func WithFrameHandler(fn func(path string, frame StreamFrame)) Option {
+	return func(c *Client) {
+		c.frameHandler = fn
+	}
+}
+
+// frame passes a frame to the client's frame handler, if any.
+func (s *OutputStream) frame(f StreamFrame) {
+	if s.client.frameHandler != nil {
+		s.client.frameHandler(s.path, f)
+	}
+}
+
+// keepalive starts pinging the server if pings are enabled.
+func (s *OutputStream) keepalive() {
+	if s.client.pingInterval <= 0 {
+		return
+	}
+	s.ws.SetPongHandler(func(data string) error {
+		s.extendDeadline()
+		if sent, err := strconv.ParseInt(data, 10, 64); err == nil {
+			s.frame(PongFrame{RTT: time.Since(time.Unix(0, sent))})
+		}
+		return nil
+	})
+	s.extendDeadline()
+	go s.ping()
+}
+
+// ping pings the server every ping interval until the stream ends. The ping
+// carries the time it was sent so that pongs give the round-trip time.
+func (s *OutputStream) ping() {
+	t := time.NewTicker(s.client.pingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			now := time.Now()
+			data := []byte(strconv.FormatInt(now.UnixNano(), 10))
+			if err := s.ws.WriteControl(websocket.PingMessage, data, now.Add(s.client.pongTimeout)); err != nil {
+				// The reader finds out as well, or times out.
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// extendDeadline extends the read deadline after a frame has been received.
+func (s *OutputStream) extendDeadline() {
+	if s.client.pingInterval > 0 {
+		s.ws.SetReadDeadline(time.Now().Add(s.client.pingInterval + s.client.pongTimeout))
+	}
+}
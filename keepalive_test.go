@@ -0,0 +1,93 @@
+package nbiot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func TestStreamFrames(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	frames := make(chan StreamFrame, 100)
+	client, err := NewWithOptions(srv.URL, srv.Token,
+		WithStreamKeepalive(20*time.Millisecond, time.Second),
+		WithFrameHandler(func(path string, f StreamFrame) { frames <- f }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	srv.SendFrame(map[string]string{"type": "KeepAlive"})
+	srv.SendFrame(map[string]string{"type": "notice", "message": "maintenance"})
+
+	var keepalive, pong bool
+	var raw *RawFrame
+	timeout := time.After(time.Second)
+	for !keepalive || !pong || raw == nil {
+		select {
+		case f := <-frames:
+			switch f := f.(type) {
+			case KeepaliveFrame:
+				keepalive = true
+			case PongFrame:
+				pong = f.RTT > 0
+			case RawFrame:
+				raw = &f
+			}
+		case <-timeout:
+			t.Fatalf("missing frames: keepalive %v, pong %v, raw %v", keepalive, pong, raw)
+		}
+	}
+	if raw.Type != "notice" || strings.TrimSpace(string(raw.Data)) != `{"message":"maintenance","type":"notice"}` {
+		t.Fatalf("unexpected frame: %s %s", raw.Type, raw.Data)
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithOptions(srv.URL, srv.Token, WithStreamKeepalive(20*time.Millisecond, 20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// The stream stays up while pongs arrive.
+	select {
+	case <-stream.Done():
+		t.Fatal("stream ended:", stream.Err())
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	srv.StallStreams()
+	select {
+	case <-stream.Done():
+	case <-time.After(time.Second):
+		t.Fatal("dead connection not detected")
+	}
+	if !errors.Is(stream.Err(), ErrStreamTimeout) {
+		t.Fatal("expected ErrStreamTimeout, got", stream.Err())
+	}
+}
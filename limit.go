@@ -0,0 +1,187 @@
+package nbiot
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointClass groups API endpoints for rate limiting.
+type EndpointClass int
+
+// These are the endpoint classes.
+const (
+	ReadEndpoints  EndpointClass = iota // GET requests other than data queries
+	WriteEndpoints                      // POST, PATCH and DELETE requests other than sends
+	DataEndpoints                       // DeviceData and CollectionData
+	SendEndpoints                       // Send and Broadcast
+)
+
+func endpointClass(method, path string) EndpointClass {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	switch {
+	case method == http.MethodGet && strings.HasSuffix(path, "/data"):
+		return DataEndpoints
+	case method == http.MethodGet:
+		return ReadEndpoints
+	case method == http.MethodPost && strings.HasSuffix(path, "/to"):
+		return SendEndpoints
+	}
+	return WriteEndpoints
+}
+
+// Limiter limits the rate of requests with a token bucket and the number of
+// concurrent requests with a semaphore. A Limiter is safe for concurrent use
+// and may be shared between clients.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	sem    chan struct{}
+
+	waiting   int
+	lastWait  time.Duration
+	totalWait time.Duration
+}
+
+// LimiterStats is a snapshot of a limiter's state.
+type LimiterStats struct {
+	Waiting   int           // Requests currently waiting for the limiter
+	InFlight  int           // Requests currently in flight
+	LastWait  time.Duration // Time the most recent request waited
+	TotalWait time.Duration // Total time all requests have waited
+}
+
+// NewLimiter creates a limiter that allows rate requests per second with
+// bursts of up to burst requests and at most maxInFlight concurrent requests.
+// A zero rate or maxInFlight disables the respective limit.
+func NewLimiter(rate float64, burst, maxInFlight int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+	if maxInFlight > 0 {
+		l.sem = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// WithLimiter makes all requests from the client wait for l.
+func WithLimiter(l *Limiter) Option {
+	return func(c *Client) {
+		c.limiter = l
+	}
+}
+
+// WithEndpointLimiter makes requests in the given endpoint class wait for l,
+// in addition to any limiter set with WithLimiter.
+func WithEndpointLimiter(class EndpointClass, l *Limiter) Option {
+	return func(c *Client) {
+		if c.classLimiters == nil {
+			c.classLimiters = make(map[EndpointClass]*Limiter)
+		}
+		c.classLimiters[class] = l
+	}
+}
+
+// Stats returns the limiter's current state.
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStats{
+		Waiting:   l.waiting,
+		InFlight:  len(l.sem),
+		LastWait:  l.lastWait,
+		TotalWait: l.totalWait,
+	}
+}
+
+// acquire waits until a request may be made. The returned function must be
+// called when the request is done.
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	start := time.Now()
+	l.mu.Lock()
+	l.waiting++
+	delay := l.reserve(start)
+	l.mu.Unlock()
+
+	err := sleep(ctx, delay)
+	if err == nil && l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waiting--
+	if err != nil {
+		if l.rate > 0 {
+			l.tokens++
+		}
+		return nil, err
+	}
+	l.lastWait = time.Since(start)
+	l.totalWait += l.lastWait
+	return l.release, nil
+}
+
+// reserve takes a token from the bucket and returns how long to wait until it
+// is available. l.mu must be held.
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func (l *Limiter) release() {
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// acquireLimiters waits for the client's limiters that apply to the request.
+func (c *Client) acquireLimiters(ctx context.Context, method, path string) (func(), error) {
+	var releases []func()
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+	for _, l := range []*Limiter{c.limiter, c.classLimiters[endpointClass(method, path)]} {
+		if l == nil {
+			continue
+		}
+		r, err := l.acquire(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
@@ -0,0 +1,92 @@
+package nbiot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEndpointClass(t *testing.T) {
+	for _, test := range []struct {
+		method, path string
+		class        EndpointClass
+	}{
+		{http.MethodGet, "/collections/1/devices/2", ReadEndpoints},
+		{http.MethodGet, "/collections/1/data?since=0&until=0&limit=0", DataEndpoints},
+		{http.MethodPatch, "/collections/1", WriteEndpoints},
+		{http.MethodDelete, "/collections/1/tags/to", WriteEndpoints},
+		{http.MethodPost, "/collections/1/devices/2/to", SendEndpoints},
+		{http.MethodPost, "/collections/1/to", SendEndpoints},
+	} {
+		if class := endpointClass(test.method, test.path); class != test.class {
+			t.Errorf("endpointClass(%s, %s) = %v; want %v", test.method, test.path, class, test.class)
+		}
+	}
+}
+
+func TestLimiterInFlight(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	l := NewLimiter(0, 0, 2)
+	client, err := NewWithOptions(srv.URL, "token", WithoutPing(), WithEndpointLimiter(ReadEndpoints, l))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Device("1", "2"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Fatal("too many requests in flight:", maxInFlight)
+	}
+	if stats := l.Stats(); stats.InFlight != 0 || stats.Waiting != 0 || stats.TotalWait == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := NewLimiter(100, 1, 0)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		release, err := l.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if d := time.Since(start); d < 35*time.Millisecond {
+		t.Fatal("limiter too fast:", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.acquire(ctx); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+}
@@ -0,0 +1,102 @@
+package nbiot
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/telenordigital/nbiot-go/internal/redact"
+)
+
+// WithLogger makes the client log API calls, retries and output stream
+// activity to logger. Request and response bodies are logged at debug level
+// with secrets redacted.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// log logs to the client's logger, if any.
+func (c *Client) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if c.logger == nil {
+		return
+	}
+	c.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// debug reports whether debug logging is enabled.
+func (c *Client) debug(ctx context.Context) bool {
+	return c.logger != nil && c.logger.Enabled(ctx, slog.LevelDebug)
+}
+
+// logRequest logs a completed REST request.
+func (c *Client) logRequest(ctx context.Context, req *Request, resp *Response, start time.Time, err error) {
+	if c.logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("path", req.Path),
+		slog.String("route", req.Route),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if n := Attempts(err); n > 1 {
+		attrs = append(attrs, slog.Int("attempts", n))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		c.log(ctx, slog.LevelWarn, "nbiot: request failed", attrs...)
+		return
+	}
+	if c.debug(ctx) {
+		attrs = append(attrs, slog.Any("header", redactedHeader(req.Header)))
+		if req.Input != nil {
+			attrs = append(attrs, slog.Any("request", redactedBody{req.Input}))
+		}
+		if req.Output != nil {
+			attrs = append(attrs, slog.Any("response", redactedBody{req.Output}))
+		}
+	}
+	c.log(ctx, slog.LevelDebug, "nbiot: request", attrs...)
+}
+
+// redactedHeader logs a header with the API token redacted.
+type redactedHeader http.Header
+
+func (h redactedHeader) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for k, v := range h {
+		if http.CanonicalHeaderKey(k) == "X-Api-Token" {
+			attrs = append(attrs, slog.String(k, redact.Placeholder))
+			continue
+		}
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// redactedBody logs a request or response body as JSON with output secrets
+// redacted.
+type redactedBody struct {
+	v interface{}
+}
+
+func (b redactedBody) LogValue() slog.Value {
+	buf, err := json.Marshal(b.v)
+	if err != nil {
+		return slog.StringValue(err.Error())
+	}
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return slog.StringValue(err.Error())
+	}
+	redact.Config(v)
+	buf, _ = json.Marshal(v)
+	return slog.StringValue(string(buf))
+}
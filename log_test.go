@@ -0,0 +1,57 @@
+package nbiot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogRedaction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Echo the output back with an ID.
+		buf, _ := ioutil.ReadAll(r.Body)
+		w.Write(bytes.Replace(buf, []byte(`"outputId":""`), []byte(`"outputId":"1"`), 1))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := NewWithOptions(srv.URL, "secret-token", WithoutPing(), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, o := range []Output{
+		WebHookOutput{URL: "http://example.com", BasicAuthUser: "user", BasicAuthPass: "secret-pass"},
+		MQTTOutput{Endpoint: "mqtt://example.com", Username: "user", Password: "secret-pass"},
+		IFTTTOutput{Key: "secret-key", EventName: "event"},
+	} {
+		if _, err := client.CreateOutput("1", o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logs := buf.String()
+	if strings.Count(logs, `"msg":"nbiot: request"`) != 3 {
+		t.Fatal("requests not logged:", logs)
+	}
+	if strings.Contains(logs, "secret") {
+		t.Fatal("secrets not redacted:", logs)
+	}
+	if !strings.Contains(logs, "user") {
+		t.Fatal("non-secret fields redacted:", logs)
+	}
+}
+
+func TestRedactedHeader(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	logger.Info("test", "header", redactedHeader{"X-Api-Token": {"secret"}, "User-Agent": {"nbiot-go"}})
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), "nbiot-go") {
+		t.Fatal("unexpected log:", buf.String())
+	}
+}
@@ -0,0 +1,154 @@
+package nbiot
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Transport is the transport a message was sent with.
+type Transport string
+
+// These are the transports of messages.
+const (
+	TransportUDP  Transport = "udp"
+	TransportCoAP Transport = "coap"
+)
+
+// OutputDataMessage represents a message sent by a device.
+type OutputDataMessage struct {
+	Device       Device       `json:"device"`
+	Payload      []byte       `json:"payload"`
+	Received     int64        `json:"received,string"` // Milliseconds since the epoch
+	Transport    Transport    `json:"transport"`
+	CoAPMetaData CoAPMetadata `json:"coapMetaData"`
+	UDPMetaData  UDPMetadata  `json:"udpMetaData"`
+
+	// Fields are the fields decoded from the payload, if the client has
+	// decoders. See WithDecoders.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
+	// Extra holds fields that aren't known by this version of the client.
+	// They are kept when the message is encoded as JSON again.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// ReceivedTime returns the time the message was received.
+func (m OutputDataMessage) ReceivedTime() time.Time {
+	return time.Unix(0, m.Received*int64(time.Millisecond))
+}
+
+// Metadata returns the metadata for the message's transport: UDPMetadata,
+// CoAPMetadata or UnknownMetadata.
+func (m OutputDataMessage) Metadata() Metadata {
+	switch m.Transport {
+	case TransportUDP:
+		return m.UDPMetaData
+	case TransportCoAP:
+		return m.CoAPMetaData
+	}
+	return UnknownMetadata{Name: m.Transport, Raw: m.Extra}
+}
+
+// Metadata is transport-specific metadata for a message.
+type Metadata interface {
+	Transport() Transport
+}
+
+// UDPMetadata is the metadata for messages sent with UDP.
+type UDPMetadata struct {
+	LocalPort  int `json:"localPort"`  // The port the message was sent to
+	RemotePort int `json:"remotePort"` // The port the message was sent from
+}
+
+// Transport returns TransportUDP.
+func (UDPMetadata) Transport() Transport { return TransportUDP }
+
+// CoAPMetadata is the metadata for messages sent with CoAP.
+type CoAPMetadata struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// Transport returns TransportCoAP.
+func (CoAPMetadata) Transport() Transport { return TransportCoAP }
+
+// UnknownMetadata is the metadata for messages sent with transports unknown
+// to this version of the client. Raw holds the message's unknown fields,
+// which is where its metadata is likely to be.
+type UnknownMetadata struct {
+	Name Transport
+	Raw  map[string]json.RawMessage
+}
+
+// Transport returns the name of the transport.
+func (m UnknownMetadata) Transport() Transport { return m.Name }
+
+// outputDataMessage has the fields of OutputDataMessage without its methods.
+type outputDataMessage OutputDataMessage
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *OutputDataMessage) UnmarshalJSON(b []byte) error {
+	var msg outputDataMessage
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	for name, value := range fields {
+		if knownMessageField(name) {
+			continue
+		}
+		if msg.Extra == nil {
+			msg.Extra = make(map[string]json.RawMessage)
+		}
+		msg.Extra[name] = value
+	}
+	*m = OutputDataMessage(msg)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m OutputDataMessage) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(outputDataMessage(m))
+	if err != nil || len(m.Extra) == 0 {
+		return b, err
+	}
+
+	names := make([]string, 0, len(m.Extra))
+	for name := range m.Extra {
+		if !knownMessageField(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	buf := bytes.NewBuffer(b[:len(b)-1])
+	for _, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(m.Extra[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// knownMessageField reports whether name is a field of OutputDataMessage. Like
+// encoding/json, it ignores case.
+func knownMessageField(name string) bool {
+	for _, known := range []string{"device", "payload", "received", "transport", "coapMetaData", "udpMetaData", "fields"} {
+		if strings.EqualFold(name, known) {
+			return true
+		}
+	}
+	return false
+}
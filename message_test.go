@@ -0,0 +1,64 @@
+package nbiot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestOutputDataMessageJSON(t *testing.T) {
+	in := `{"device":{"deviceId":"d","collectionId":"c"},"payload":"AQI=","received":"1500000000123","transport":"udp",` +
+		`"coapMetaData":{"method":"","path":""},"udpMetaData":{"localPort":1234,"remotePort":4321},"rssi":-70,"z":{"a":1}}`
+
+	var msg OutputDataMessage
+	if err := json.Unmarshal([]byte(in), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Device.ID != "d" || msg.Received != 1500000000123 || msg.UDPMetaData.LocalPort != 1234 {
+		t.Fatal("unexpected message:", msg)
+	}
+	if len(msg.Extra) != 2 || string(msg.Extra["rssi"]) != "-70" {
+		t.Fatal("unexpected extra fields:", msg.Extra)
+	}
+	if !msg.ReceivedTime().Equal(time.Unix(1500000000, 123000000)) {
+		t.Fatal("unexpected time:", msg.ReceivedTime())
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want map[string]interface{}
+	json.Unmarshal(b, &got)
+	json.Unmarshal([]byte(in), &want)
+	if got["rssi"] != want["rssi"] || got["z"].(map[string]interface{})["a"] != 1.0 || got["received"] != want["received"] {
+		t.Fatalf("fields lost in %s", b)
+	}
+
+	msg.Extra = map[string]json.RawMessage{"bad": json.RawMessage("{")}
+	if _, err := json.Marshal(msg); err == nil {
+		t.Fatal("expected error for invalid extra field")
+	}
+}
+
+func TestOutputDataMessageMetadata(t *testing.T) {
+	msg := OutputDataMessage{Transport: TransportUDP}
+	msg.UDPMetaData.LocalPort = 1234
+	if md, ok := msg.Metadata().(UDPMetadata); !ok || md.LocalPort != 1234 || md.Transport() != TransportUDP {
+		t.Fatal("unexpected metadata:", msg.Metadata())
+	}
+
+	msg = OutputDataMessage{Transport: TransportCoAP}
+	msg.CoAPMetaData.Path = "/a"
+	if md, ok := msg.Metadata().(CoAPMetadata); !ok || md.Path != "/a" || md.Transport() != TransportCoAP {
+		t.Fatal("unexpected metadata:", msg.Metadata())
+	}
+
+	if err := json.Unmarshal([]byte(`{"transport":"lwm2m","lwm2mMetaData":{"object":3}}`), &msg); err != nil {
+		t.Fatal(err)
+	}
+	md, ok := msg.Metadata().(UnknownMetadata)
+	if !ok || md.Transport() != "lwm2m" || string(md.Raw["lwm2mMetaData"]) != `{"object":3}` {
+		t.Fatal("unexpected metadata:", msg.Metadata())
+	}
+}
@@ -0,0 +1,82 @@
+package nbiot
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// MetricsSink receives metrics from the client. Set it with WithMetrics.
+// Implementations must be safe for concurrent use.
+type MetricsSink interface {
+	// RequestDone is called when an API call is done, after any retries.
+	RequestDone(m RequestMetrics)
+
+	// StreamOpened is called when an output stream is established.
+	StreamOpened(collectionID string)
+
+	// StreamClosed is called when an output stream ends.
+	StreamClosed(collectionID string)
+
+	// MessageReceived is called for each message received on an output
+	// stream.
+	MessageReceived(collectionID string, payloadSize int)
+
+	// StreamReconnected is called when a stream reconnects after losing
+	// its connection.
+	StreamReconnected(collectionID string)
+}
+
+// RequestMetrics describes a completed API call.
+type RequestMetrics struct {
+	Method        string
+	Route         string // The route template, e.g. /collections/{id}
+	StatusCode    int    // The final status code, or 0 if there was no response
+	Duration      time.Duration
+	Attempts      int   // The number of attempts made, including retries
+	BytesSent     int64 // Request body bytes sent, summed over all attempts
+	BytesReceived int64 // Response body bytes received, summed over all attempts
+}
+
+// WithMetrics makes the client report metrics to sink.
+func WithMetrics(sink MetricsSink) Option {
+	return func(c *Client) {
+		c.metrics = sink
+		c.streamObservers = append(c.streamObservers, metricsObserver{sink})
+	}
+}
+
+// metricsObserver reports output stream metrics to a sink.
+type metricsObserver struct {
+	sink MetricsSink
+}
+
+func (o metricsObserver) StreamOpened(ctx context.Context, req *Request) StreamSession {
+	o.sink.StreamOpened(req.CollectionID)
+	return metricsSession{o.sink, req.CollectionID}
+}
+
+type metricsSession struct {
+	sink         MetricsSink
+	collectionID string
+}
+
+func (s metricsSession) Message(msg OutputDataMessage) {
+	s.sink.MessageReceived(s.collectionID, len(msg.Payload))
+}
+
+func (s metricsSession) Closed(err error) {
+	s.sink.StreamClosed(s.collectionID)
+}
+
+// countingReader counts the bytes read from a response body.
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,123 @@
+package nbiot
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Request is an API request as seen by interceptors. Interceptors may modify
+// the header before passing the request on.
+type Request struct {
+	Method       string
+	Path         string      // The request path, including any query string
+	Route        string      // The route template, e.g. /collections/{id}/devices/{id}
+	CollectionID string      // The collection in the path, if any
+	DeviceID     string      // The device in the path, if any
+	Header       http.Header // The request headers, except for the API token
+	Input        interface{} // The value sent as the request body, if any
+	Output       interface{} // The value the response body is decoded into, if any
+	Stream       bool        // Whether the request is an output stream handshake
+}
+
+// Response is the response to a Request. For REST requests the body has been
+// decoded into the request's Output when the handler returns.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+}
+
+// Handler handles a Request. The response is nil if the request failed
+// without a response from the server.
+type Handler func(ctx context.Context, req *Request) (*Response, error)
+
+// Interceptor wraps a Handler, e.g. to inspect or modify requests and
+// responses. Interceptors apply to REST requests and to the websocket
+// handshake of output streams. Retries happen inside the chain, so an
+// interceptor sees each call once.
+type Interceptor func(next Handler) Handler
+
+// WithInterceptors adds interceptors to the client. The first interceptor is
+// the outermost one.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+func (c *Client) newRequest(method, path string) *Request {
+	r := parseRoute(path)
+	return &Request{
+		Method:       method,
+		Path:         path,
+		Route:        r.Template,
+		CollectionID: r.CollectionID,
+		DeviceID:     r.DeviceID,
+		Header:       http.Header{"User-Agent": {c.userAgent}},
+	}
+}
+
+// chain wraps h in the client's interceptors.
+func (c *Client) chain(h Handler) Handler {
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		h = c.interceptors[i](h)
+	}
+	return h
+}
+
+// HeaderInterceptor adds header to every request.
+func HeaderInterceptor(header http.Header) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			for k, v := range header {
+				req.Header[http.CanonicalHeaderKey(k)] = v
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// TimingInterceptor calls fn with the duration of every request. The response
+// is nil if the request failed without a response from the server.
+func TimingInterceptor(fn func(req *Request, resp *Response, d time.Duration, err error)) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			fn(req, resp, time.Since(start), err)
+			return resp, err
+		}
+	}
+}
+
+// LoggingInterceptor logs every request to logger, or to the default logger
+// if logger is nil. Failed requests are logged at warn level and the rest at
+// info level. WithLogger logs retries and bodies as well.
+func LoggingInterceptor(logger *slog.Logger) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("path", req.Path),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if resp != nil {
+				attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.Any("error", err))
+				l.LogAttrs(ctx, slog.LevelWarn, "nbiot: request failed", attrs...)
+			} else {
+				l.LogAttrs(ctx, slog.LevelInfo, "nbiot: request", attrs...)
+			}
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package nbiot
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestInterceptors(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "yes" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/from") {
+			ws, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			ws.Close()
+			return
+		}
+		w.Write([]byte(`{"deviceId":"2"}`))
+	}))
+	defer srv.Close()
+
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, req *Request) (*Response, error) {
+				calls = append(calls, name)
+				return next(ctx, req)
+			}
+		}
+	}
+	var timed []*Request
+	timing := TimingInterceptor(func(req *Request, resp *Response, d time.Duration, err error) {
+		if err != nil || resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Error(req.Path, resp, err)
+		}
+		timed = append(timed, req)
+	})
+
+	client, err := NewWithOptions(srv.URL, "token",
+		WithoutPing(),
+		WithInterceptors(record("outer"), record("inner")),
+		WithInterceptors(HeaderInterceptor(http.Header{"x-test": {"yes"}}), timing))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := client.Device("1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.ID != "2" {
+		t.Fatal("unexpected device:", device)
+	}
+	if strings.Join(calls, ",") != "outer,inner" {
+		t.Fatal("unexpected order:", calls)
+	}
+	req := timed[0]
+	if req.Route != "/collections/{id}/devices/{id}" || req.CollectionID != "1" || req.DeviceID != "2" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if d, ok := req.Output.(*Device); !ok || d.ID != "2" {
+		t.Fatalf("output not decoded: %#v", req.Output)
+	}
+
+	stream, err := client.DeviceOutputStream("1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if len(timed) != 2 || !timed[1].Stream || timed[1].Route != "/collections/{id}/devices/{id}/from" {
+		t.Fatalf("stream handshake not intercepted: %+v", timed)
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"deviceId":"2"}`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	client, err := NewWithOptions(srv.URL, "token", WithoutPing(), WithInterceptors(LoggingInterceptor(logger)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Device("1", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Device("1", "missing"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got:\n%s", buf.String())
+	}
+	if !strings.Contains(lines[0], "level=INFO") || !strings.Contains(lines[0], "path=/collections/1/devices/2") || !strings.Contains(lines[0], "status=200") {
+		t.Error("unexpected log line:", lines[0])
+	}
+	if !strings.Contains(lines[1], "level=WARN") || !strings.Contains(lines[1], "status=404") || !strings.Contains(lines[1], "error=") {
+		t.Error("unexpected log line:", lines[1])
+	}
+}
@@ -0,0 +1,301 @@
+package nbiotbin
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"reflect"
+)
+
+// ShortFrameError is returned by Unmarshal when a frame ends before a field.
+type ShortFrameError struct {
+	Field  string // The name of the field, e.g. "Position.Latitude"
+	Offset int    // The offset of the field in bits
+	Bits   int    // The width of the field
+	Have   int    // The number of bits left in the frame
+}
+
+func (e *ShortFrameError) Error() string {
+	return fmt.Sprintf("nbiotbin: frame too short for %s: need %d bits at bit %d, have %d", e.Field, e.Bits, e.Offset, e.Have)
+}
+
+// Unmarshal decodes a frame into the struct pointed to by v. Conditional
+// fields that aren't present are set to their zero value. It is an error if
+// the frame has whole bytes left over.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("nbiotbin: Unmarshal of non-pointer %T", v)
+	}
+	s, err := SchemaOf(v)
+	if err != nil {
+		return err
+	}
+	r := &bitReader{data: data}
+	if err := s.decode(r, rv.Elem(), ""); err != nil {
+		return err
+	}
+	if left := len(data)*8 - r.pos; left >= 8 {
+		return fmt.Errorf("nbiotbin: %d bytes left after decoding %s", left/8, s.typ.Name())
+	}
+	return nil
+}
+
+// Marshal encodes the struct v, or the struct v points to, into a frame. The
+// last byte is padded with zero bits.
+func Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("nbiotbin: Marshal of nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	s, err := SchemaOf(v)
+	if err != nil {
+		return nil, err
+	}
+	w := &bitWriter{}
+	if err := s.encode(w, rv, ""); err != nil {
+		return nil, err
+	}
+	return w.data, nil
+}
+
+func (s *Schema) decode(r *bitReader, v reflect.Value, prefix string) error {
+	for _, f := range s.fields {
+		fv := v.Field(f.index)
+		if f.cond != nil && !f.cond.holds(v) {
+			// Reserved fields are unexported and can't be set.
+			if !f.blank {
+				fv.Set(reflect.Zero(fv.Type()))
+			}
+			continue
+		}
+		if f.rest {
+			var rest []byte
+			for {
+				b, ok := r.read(8)
+				if !ok {
+					break
+				}
+				rest = append(rest, byte(b))
+			}
+			if !f.blank {
+				fv.SetBytes(rest)
+			}
+			continue
+		}
+		if f.count == 0 {
+			if err := f.decode(r, fv, prefix+f.name); err != nil {
+				return err
+			}
+			continue
+		}
+		for i := 0; i < f.count; i++ {
+			if err := f.decode(r, fv.Index(i), fmt.Sprintf("%s%s[%d]", prefix, f.name, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *field) decode(r *bitReader, v reflect.Value, name string) error {
+	if f.sub != nil {
+		return f.sub.decode(r, v, name+".")
+	}
+	raw, ok := r.read(f.bits)
+	if !ok {
+		return &ShortFrameError{Field: name, Offset: r.pos, Bits: f.bits, Have: len(r.data)*8 - r.pos}
+	}
+	if f.blank {
+		return nil
+	}
+	if f.little {
+		raw = bits.ReverseBytes64(raw) >> (64 - f.bits)
+	}
+
+	switch f.kind {
+	case reflect.Bool:
+		v.SetBool(raw != 0)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		v.SetInt(signExtend(raw, f.bits))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		v.SetUint(raw)
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case f.scaled && f.signed:
+			v.SetFloat(float64(signExtend(raw, f.bits))*f.scale + f.offset)
+		case f.scaled:
+			v.SetFloat(float64(raw)*f.scale + f.offset)
+		case f.bits == 32:
+			v.SetFloat(float64(math.Float32frombits(uint32(raw))))
+		default:
+			v.SetFloat(math.Float64frombits(raw))
+		}
+	}
+	return nil
+}
+
+func (s *Schema) encode(w *bitWriter, v reflect.Value, prefix string) error {
+	for _, f := range s.fields {
+		if f.cond != nil && !f.cond.holds(v) {
+			continue
+		}
+		fv := v.Field(f.index)
+		if f.rest {
+			for _, b := range fv.Bytes() {
+				w.write(uint64(b), 8)
+			}
+			continue
+		}
+		if f.count == 0 {
+			if err := f.encode(w, fv, prefix+f.name); err != nil {
+				return err
+			}
+			continue
+		}
+		for i := 0; i < f.count; i++ {
+			if err := f.encode(w, fv.Index(i), fmt.Sprintf("%s%s[%d]", prefix, f.name, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *field) encode(w *bitWriter, v reflect.Value, name string) error {
+	if f.sub != nil {
+		return f.sub.encode(w, v, name+".")
+	}
+	if f.blank {
+		w.write(0, f.bits)
+		return nil
+	}
+
+	var raw uint64
+	var err error
+	switch f.kind {
+	case reflect.Bool:
+		if v.Bool() {
+			raw = 1
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		raw, err = fitSigned(v.Int(), f.bits)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		raw, err = fitUnsigned(v.Uint(), f.bits)
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case f.scaled:
+			x := math.Round((v.Float() - f.offset) / f.scale)
+			if math.IsNaN(x) || math.IsInf(x, 0) || math.Abs(x) >= 1<<63 {
+				err = fmt.Errorf("%v doesn't fit %d bits", v.Float(), f.bits)
+			} else if f.signed {
+				raw, err = fitSigned(int64(x), f.bits)
+			} else if x < 0 {
+				err = fmt.Errorf("%v is below the offset", v.Float())
+			} else {
+				raw, err = fitUnsigned(uint64(x), f.bits)
+			}
+		case f.bits == 32:
+			raw = uint64(math.Float32bits(float32(v.Float())))
+		default:
+			raw = math.Float64bits(v.Float())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("nbiotbin: %s: %v", name, err)
+	}
+	if f.little {
+		raw = bits.ReverseBytes64(raw) >> (64 - f.bits)
+	}
+	w.write(raw, f.bits)
+	return nil
+}
+
+// holds reports whether the condition holds for the struct v.
+func (c *condition) holds(v reflect.Value) bool {
+	var x uint64
+	fv := v.Field(c.field.index)
+	switch fv.Kind() {
+	case reflect.Bool:
+		if fv.Bool() {
+			x = 1
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		x = uint64(fv.Int())
+	default:
+		x = fv.Uint()
+	}
+	switch c.op {
+	case "==":
+		return x == c.value
+	case "!=":
+		return x != c.value
+	case "&":
+		return x&c.value != 0
+	}
+	return x != 0
+}
+
+func signExtend(raw uint64, n int) int64 {
+	shift := 64 - n
+	return int64(raw<<shift) >> shift
+}
+
+func fitSigned(x int64, n int) (uint64, error) {
+	if n < 64 && (x < -(1<<(n-1)) || x >= 1<<(n-1)) {
+		return 0, fmt.Errorf("%d doesn't fit %d bits", x, n)
+	}
+	return uint64(x) & mask(n), nil
+}
+
+func fitUnsigned(x uint64, n int) (uint64, error) {
+	if x&^mask(n) != 0 {
+		return 0, fmt.Errorf("%d doesn't fit %d bits", x, n)
+	}
+	return x, nil
+}
+
+func mask(n int) uint64 {
+	if n >= 64 {
+		return math.MaxUint64
+	}
+	return 1<<n - 1
+}
+
+// bitReader reads bits, most significant first.
+type bitReader struct {
+	data []byte
+	pos  int // In bits
+}
+
+func (r *bitReader) read(n int) (uint64, bool) {
+	if r.pos+n > len(r.data)*8 {
+		return 0, false
+	}
+	var v uint64
+	for i := 0; i < n; i++ {
+		bit := r.data[(r.pos+i)/8] >> (7 - uint(r.pos+i)%8) & 1
+		v = v<<1 | uint64(bit)
+	}
+	r.pos += n
+	return v, true
+}
+
+// bitWriter writes bits, most significant first.
+type bitWriter struct {
+	data []byte
+	pos  int // In bits
+}
+
+func (w *bitWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[w.pos/8] |= byte(v>>uint(i)&1) << (7 - uint(w.pos)%8)
+		w.pos++
+	}
+}
@@ -0,0 +1,163 @@
+package nbiotbin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type frame struct {
+	Version     uint8   `bin:"bits=4"`
+	HasGPS      bool    // One bit
+	_           uint8   `bin:"bits=3"` // Reserved
+	Temperature float64 `bin:"bits=12,signed,scale=0.1,offset=-20"`
+	Alarms      uint8   `bin:"bits=4"`
+	Battery     uint16  `bin:"endian=little"`
+	Latitude    float32 `bin:"if=HasGPS"`
+	Longitude   float32 `bin:"if=HasGPS"`
+}
+
+func TestMarshal(t *testing.T) {
+	f := frame{Version: 1, HasGPS: true, Temperature: 21.5, Alarms: 5, Battery: 3600, Latitude: 63.43, Longitude: 10.39}
+	b, err := Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x18, 0x19, 0xf5, 0x10, 0x0e}
+	want = binary.BigEndian.AppendUint32(want, math.Float32bits(63.43))
+	want = binary.BigEndian.AppendUint32(want, math.Float32bits(10.39))
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+
+	var got frame
+	if err := Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got.Temperature-f.Temperature) > 1e-9 {
+		t.Fatalf("got temperature %v", got.Temperature)
+	}
+	got.Temperature = f.Temperature
+	if got != f {
+		t.Fatalf("got %+v, want %+v", got, f)
+	}
+
+	// Without GPS the position is left out.
+	f = frame{Version: 2, Temperature: -20}
+	if b, err = Marshal(&f); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte{0x20, 0x00, 0x00, 0x00, 0x00}) {
+		t.Fatalf("got %x", b)
+	}
+	got = frame{Latitude: 1}
+	if err := Unmarshal(b, &got); err != nil || got != f {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	type sample struct {
+		Delta int8 `bin:"bits=6"`
+		Flag  bool
+		_     bool
+	}
+	type record struct {
+		Kind    uint8 `bin:"bits=3"`
+		Mode    uint8 `bin:"bits=5"`
+		Samples [3]sample
+		Extra   uint32 `bin:"bits=24,if=Kind==2"`
+		Mask    uint16 `bin:"if=Mode&0x10"`
+		Rest    []byte
+	}
+
+	for _, frame := range [][]byte{
+		{0x40, 0xfc, 0x04, 0xaa, 0x00, 0x00, 0x01},
+		{0x50, 0x00, 0x00, 0x00, 0x12, 0x34, 0x56, 0xff, 0xff, 1, 2, 3},
+		{0x00, 0x00, 0x00, 0x00},
+	} {
+		var r record
+		if err := Unmarshal(frame, &r); err != nil {
+			t.Fatalf("%x: %v", frame, err)
+		}
+		b, err := Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, frame) {
+			t.Errorf("%x: round trip gave %x (%+v)", frame, b, r)
+		}
+	}
+
+	var r record
+	Unmarshal([]byte{0x40, 0xfc, 0x04, 0xaa, 0x00, 0x00, 0x01}, &r)
+	want := record{Kind: 2, Samples: [3]sample{{Delta: -1, Flag: false}, {Delta: 1}, {Delta: -22, Flag: true}}, Extra: 1}
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("got %+v, want %+v", r, want)
+	}
+}
+
+func TestConditionalReserved(t *testing.T) {
+	type frame struct {
+		Extended bool
+		Kind     uint8 `bin:"bits=7"`
+		_        uint8 `bin:"if=Extended"`
+		Value    uint8
+	}
+	for frameBytes, want := range map[string]frame{
+		"\x01\x02":     {Kind: 1, Value: 2},
+		"\x81\xff\x02": {Extended: true, Kind: 1, Value: 2},
+	} {
+		var f frame
+		if err := Unmarshal([]byte(frameBytes), &f); err != nil {
+			t.Fatalf("%x: %v", frameBytes, err)
+		}
+		if f != want {
+			t.Fatalf("%x: got %+v, want %+v", frameBytes, f, want)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var f frame
+	err := Unmarshal([]byte{0x18, 0x19, 0xf5, 0x10, 0x0e, 0x42}, &f)
+	var short *ShortFrameError
+	if !errors.As(err, &short) || short.Field != "Latitude" || short.Offset != 40 || short.Bits != 32 || short.Have != 8 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err.Error() != "nbiotbin: frame too short for Latitude: need 32 bits at bit 40, have 8" {
+		t.Fatal(err)
+	}
+
+	if err := Unmarshal([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, &f); err == nil {
+		t.Fatal("expected error for trailing byte")
+	}
+	if err := Unmarshal([]byte{0}, f); err == nil {
+		t.Fatal("expected error for non-pointer")
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	for _, f := range []frame{
+		{Version: 16},
+		{Temperature: 300},
+		{Temperature: math.NaN()},
+	} {
+		if _, err := Marshal(f); err == nil {
+			t.Errorf("%+v: expected error", f)
+		}
+	}
+
+	type unsignedScaled struct {
+		V float64 `bin:"bits=8,scale=0.5"`
+	}
+	if _, err := Marshal(unsignedScaled{V: -1}); err == nil {
+		t.Error("expected error for negative unsigned value")
+	}
+	if _, err := Marshal((*frame)(nil)); err == nil {
+		t.Error("expected error for nil pointer")
+	}
+}
@@ -0,0 +1,61 @@
+package nbiotbin
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/telenordigital/nbiot-go"
+)
+
+// NewDecoder returns an nbiot.Decoder that decodes payloads into the struct
+// type of prototype and returns its fields. Fields are named after their json
+// tags, or their Go names without one. Nested structs become maps and arrays
+// become slices; conditional fields that aren't present are left out.
+func NewDecoder(prototype interface{}) (nbiot.Decoder, error) {
+	s, err := SchemaOf(prototype)
+	if err != nil {
+		return nil, err
+	}
+	return nbiot.DecoderFunc(func(payload []byte) (map[string]interface{}, error) {
+		v := reflect.New(s.typ)
+		if err := Unmarshal(payload, v.Interface()); err != nil {
+			return nil, err
+		}
+		return s.fieldMap(v.Elem()), nil
+	}), nil
+}
+
+func (s *Schema) fieldMap(v reflect.Value) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, f := range s.fields {
+		if f.blank || (f.cond != nil && !f.cond.holds(v)) {
+			continue
+		}
+		name := f.name
+		if tag, _, _ := strings.Cut(s.typ.Field(f.index).Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		fv := v.Field(f.index)
+		switch {
+		case f.count > 0:
+			elems := make([]interface{}, f.count)
+			for i := range elems {
+				elems[i] = f.value(fv.Index(i))
+			}
+			m[name] = elems
+		default:
+			m[name] = f.value(fv)
+		}
+	}
+	return m
+}
+
+func (f *field) value(v reflect.Value) interface{} {
+	if f.sub != nil {
+		return f.sub.fieldMap(v)
+	}
+	return v.Interface()
+}
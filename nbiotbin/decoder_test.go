@@ -0,0 +1,49 @@
+package nbiotbin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	type position struct {
+		Lat int32
+		Lon int32
+	}
+	type report struct {
+		Kind     uint8    `bin:"bits=4" json:"kind"`
+		HasPos   bool     `json:"-"`
+		_        uint8    `bin:"bits=3"`
+		Position position `bin:"if=HasPos"`
+		Levels   [2]uint8
+	}
+
+	d, err := NewDecoder(report{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := d.Decode([]byte{0x18, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xfe, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"kind":     uint8(1),
+		"Position": map[string]interface{}{"Lat": int32(1), "Lon": int32(-2)},
+		"Levels":   []interface{}{uint8(3), uint8(4)},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("got %v, want %v", fields, want)
+	}
+
+	fields, err = d.Decode([]byte{0x10, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["Position"]; ok {
+		t.Fatal("unexpected position:", fields)
+	}
+
+	if _, err := d.Decode([]byte{0x18}); err == nil {
+		t.Fatal("expected error for short frame")
+	}
+}
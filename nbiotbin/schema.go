@@ -0,0 +1,363 @@
+/*
+Package nbiotbin encodes and decodes packed binary payloads described by
+struct tags.
+
+Fields are packed in order, most significant bit first, without padding. The
+bin tag describes how each field is encoded:
+
+	type Frame struct {
+		Version     uint8   `bin:"bits=4"`
+		HasGPS      bool    // One bit
+		_           uint8   `bin:"bits=3"` // Reserved
+		Temperature float64 `bin:"bits=12,signed,scale=0.1,offset=-20"`
+		Alarms      uint8   `bin:"bits=4"`
+		Battery     uint16  `bin:"endian=little"`
+		Latitude    float32 `bin:"if=HasGPS"`
+		Longitude   float32 `bin:"if=HasGPS"`
+	}
+
+The tag options are:
+
+	bits=N       The width of the field. The default is the size of the Go
+	             type, or one bit for bool.
+	endian=E     The byte order of the field, big (the default) or little.
+	             Little endian fields must be whole bytes.
+	signed       The raw value of a scaled field is two's complement.
+	scale=F      The value of a float field is raw*scale + offset, where raw
+	offset=F     is an integer of the given width.
+	if=COND      The field is only present if COND holds for an earlier field
+	             of the same struct: Name, Name==N, Name!=N or Name&N.
+
+Fields named _ are reserved bits that are skipped when decoding and zero when
+encoding. Fields tagged bin:"-" are ignored. Nested structs and arrays are
+encoded element by element, and a []byte as the last field holds the rest of
+the frame. A struct ending with a []byte must itself be the last field, and
+can't be an array element.
+
+Marshal(Unmarshal(frame)) reproduces frame apart from reserved and padding
+bits, which are always encoded as zeros, and Unmarshal(Marshal(v)) reproduces
+v as long as its values are representable, i.e. within range and, for scaled
+fields, multiples of the scale.
+*/
+package nbiotbin
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Schema is the layout of a struct type.
+type Schema struct {
+	typ    reflect.Type
+	fields []*field
+	rest   bool // Whether the last field holds the rest of the frame
+}
+
+// field is a field of a schema.
+type field struct {
+	name   string
+	index  int
+	kind   reflect.Kind
+	bits   int
+	little bool
+	signed bool
+	scaled bool
+	scale  float64
+	offset float64
+	cond   *condition
+	count  int     // The number of elements of an array, or 0
+	sub    *Schema // The schema of a struct or struct elements
+	rest   bool    // Whether the field holds the rest of the frame
+	blank  bool
+}
+
+// condition is the condition of a conditional field.
+type condition struct {
+	field *field
+	op    string // "", "==", "!=" or "&"
+	value uint64
+}
+
+func (c *condition) String() string {
+	if c.op == "" {
+		return c.field.name
+	}
+	return fmt.Sprintf("%s%s%d", c.field.name, c.op, c.value)
+}
+
+var schemas sync.Map // reflect.Type -> *Schema
+
+// SchemaOf returns the schema of the struct type of v, which can be a struct
+// or a pointer to one.
+func SchemaOf(v interface{}) (*Schema, error) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("nbiotbin: %v is not a struct", t)
+	}
+	return schemaOf(t)
+}
+
+func schemaOf(t reflect.Type) (*Schema, error) {
+	if s, ok := schemas.Load(t); ok {
+		return s.(*Schema), nil
+	}
+	s := &Schema{typ: t}
+	byName := make(map[string]*field)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("bin")
+		if tag == "-" || (!sf.IsExported() && sf.Name != "_") {
+			continue
+		}
+		f, err := newField(sf, i, tag, byName)
+		if err != nil {
+			return nil, fmt.Errorf("nbiotbin: %s.%s: %v", t.Name(), sf.Name, err)
+		}
+		if f.rest || f.sub != nil && f.sub.rest {
+			// The rest of the frame can't be followed by anything, so an
+			// enclosing struct must be last as well.
+			if f.count > 0 {
+				return nil, fmt.Errorf("nbiotbin: %s.%s: array of structs ending with []byte", t.Name(), sf.Name)
+			}
+			if i != t.NumField()-1 {
+				return nil, fmt.Errorf("nbiotbin: %s.%s: []byte must be the last field", t.Name(), sf.Name)
+			}
+			s.rest = true
+		}
+		s.fields = append(s.fields, f)
+		if !f.blank {
+			byName[f.name] = f
+		}
+	}
+	s2, _ := schemas.LoadOrStore(t, s)
+	return s2.(*Schema), nil
+}
+
+func newField(sf reflect.StructField, index int, tag string, byName map[string]*field) (*field, error) {
+	f := &field{name: sf.Name, index: index, blank: sf.Name == "_", scale: 1}
+	t := sf.Type
+	if t.Kind() == reflect.Array {
+		f.count = t.Len()
+		t = t.Elem()
+	}
+	f.kind = t.Kind()
+	f.rest = f.kind == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+
+	for _, opt := range strings.Split(tag, ",") {
+		if opt == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(opt, "=")
+		var err error
+		switch key {
+		case "bits":
+			f.bits, err = strconv.Atoi(value)
+		case "endian":
+			switch value {
+			case "big":
+			case "little":
+				f.little = true
+			default:
+				err = fmt.Errorf("unknown endianness %q", value)
+			}
+		case "signed":
+			f.signed = true
+		case "scale":
+			f.scaled = true
+			f.scale, err = strconv.ParseFloat(value, 64)
+			if err == nil && f.scale == 0 {
+				err = fmt.Errorf("zero scale")
+			}
+		case "offset":
+			f.scaled = true
+			f.offset, err = strconv.ParseFloat(value, 64)
+		case "if":
+			f.cond, err = parseCondition(value, byName)
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.rest {
+		if f.bits != 0 || f.little || f.scaled || f.signed {
+			return nil, fmt.Errorf("[]byte fields only support if")
+		}
+		return f, nil
+	}
+
+	size := 0
+	switch f.kind {
+	case reflect.Struct:
+		if f.bits != 0 || f.little || f.scaled || f.signed {
+			return nil, fmt.Errorf("struct fields only support if")
+		}
+		sub, err := schemaOf(t)
+		if err != nil {
+			return nil, err
+		}
+		f.sub = sub
+		return f, nil
+	case reflect.Bool:
+		size = 1
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		f.signed = true
+		size = t.Bits()
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		size = t.Bits()
+	case reflect.Float32, reflect.Float64:
+		size = t.Bits()
+		if f.scaled && f.bits == 0 {
+			return nil, fmt.Errorf("scaled field without bits")
+		}
+		if !f.scaled && f.bits != 0 && f.bits != 32 && f.bits != 64 {
+			return nil, fmt.Errorf("float field with %d bits", f.bits)
+		}
+		if !f.scaled && f.bits == 64 && f.kind == reflect.Float32 {
+			return nil, fmt.Errorf("float32 field with 64 bits")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %v", t)
+	}
+	if f.scaled && f.kind != reflect.Float32 && f.kind != reflect.Float64 {
+		return nil, fmt.Errorf("scale and offset are only supported for floats")
+	}
+	if f.signed && !f.scaled {
+		switch f.kind {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		default:
+			return nil, fmt.Errorf("signed is only supported for integers and scaled floats")
+		}
+	}
+	if f.bits == 0 {
+		f.bits = size
+	}
+	if f.bits < 1 || f.bits > 64 || (!f.scaled && f.bits > size) {
+		return nil, fmt.Errorf("%d bits don't fit %v", f.bits, t)
+	}
+	if f.little && f.bits%8 != 0 {
+		return nil, fmt.Errorf("little endian field with %d bits", f.bits)
+	}
+	return f, nil
+}
+
+func parseCondition(s string, byName map[string]*field) (*condition, error) {
+	c := &condition{}
+	name := s
+	for _, op := range []string{"==", "!=", "&"} {
+		if i := strings.Index(s, op); i >= 0 {
+			value, err := strconv.ParseUint(s[i+len(op):], 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition %q", s)
+			}
+			name, c.op, c.value = s[:i], op, value
+			break
+		}
+	}
+	c.field = byName[name]
+	if c.field == nil {
+		return nil, fmt.Errorf("condition on unknown or later field %q", name)
+	}
+	switch c.field.kind {
+	case reflect.Struct, reflect.Slice, reflect.Float32, reflect.Float64:
+		return nil, fmt.Errorf("condition on non-integer field %q", name)
+	}
+	if c.field.count > 0 {
+		return nil, fmt.Errorf("condition on array field %q", name)
+	}
+	return c, nil
+}
+
+// String returns the layout of the schema as a table, e.g. for firmware
+// documentation. Offsets are in bits; after the first conditional or
+// variable-length field they depend on the frame and are shown as "-".
+func (s *Schema) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "OFFSET\tBITS\tFIELD\tTYPE\tENCODING")
+	offset := 0
+	s.dump(w, "", &offset)
+	w.Flush()
+	return b.String()
+}
+
+func (s *Schema) dump(w *tabwriter.Writer, prefix string, offset *int) {
+	for _, f := range s.fields {
+		if f.cond != nil {
+			*offset = -1
+		}
+		n := f.count
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			name := prefix + f.name
+			if f.blank {
+				name = "(reserved)"
+			}
+			if f.count > 0 {
+				name += fmt.Sprintf("[%d]", i)
+			}
+			ft := s.typ.Field(f.index).Type
+			if f.count > 0 {
+				ft = ft.Elem()
+			}
+
+			if f.sub != nil {
+				if f.cond != nil {
+					fmt.Fprintf(w, "-\t-\t%s\t%v\tif %v\n", name, ft, f.cond)
+				}
+				f.sub.dump(w, name+".", offset)
+				continue
+			}
+			off, bits := "-", "*"
+			if *offset >= 0 {
+				off = strconv.Itoa(*offset)
+			}
+			if !f.rest {
+				bits = strconv.Itoa(f.bits)
+				if *offset >= 0 {
+					*offset += f.bits
+				}
+			} else {
+				*offset = -1
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%s\n", off, bits, name, ft, f.encoding())
+		}
+	}
+}
+
+// encoding describes how a field is encoded.
+func (f *field) encoding() string {
+	var parts []string
+	switch {
+	case f.rest:
+		parts = append(parts, "rest of frame")
+	case f.scaled:
+		raw := "unsigned"
+		if f.signed {
+			raw = "signed"
+		}
+		parts = append(parts, fmt.Sprintf("%s raw * %g + %g", raw, f.scale, f.offset))
+	case f.kind == reflect.Float32 || f.kind == reflect.Float64:
+		parts = append(parts, "IEEE 754")
+	case f.signed:
+		parts = append(parts, "two's complement")
+	}
+	if f.little {
+		parts = append(parts, "little endian")
+	}
+	if f.cond != nil {
+		parts = append(parts, "if "+f.cond.String())
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,122 @@
+package nbiotbin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaString(t *testing.T) {
+	s, err := SchemaOf(&frame{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+OFFSET  BITS  FIELD        TYPE     ENCODING
+0       4     Version      uint8
+4       1     HasGPS       bool
+5       3     (reserved)   uint8
+8       12    Temperature  float64  signed raw * 0.1 + -20
+20      4     Alarms       uint8
+24      16    Battery      uint16   little endian
+-       32    Latitude     float32  IEEE 754, if HasGPS
+-       32    Longitude    float32  IEEE 754, if HasGPS
+`
+	if got := s.String(); strings.TrimSpace(trimLines(got)) != strings.TrimSpace(want) {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+// trimLines removes trailing spaces from each line.
+func trimLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSchemaErrors(t *testing.T) {
+	for _, v := range []interface{}{
+		1,
+		&struct{ A string }{},
+		&struct {
+			A uint8 `bin:"bits=9"`
+		}{},
+		&struct {
+			A uint16 `bin:"bits=12,endian=little"`
+		}{},
+		&struct {
+			A float64 `bin:"scale=0.1"`
+		}{},
+		&struct {
+			A int `bin:"scale=2,bits=8"`
+		}{},
+		&struct {
+			A uint8 `bin:"if=B"`
+			B bool
+		}{},
+		&struct {
+			A []byte
+			B uint8
+		}{},
+		&struct {
+			A uint8 `bin:"wat"`
+		}{},
+		&struct {
+			A []byte `bin:"bits=8"`
+		}{},
+		&struct {
+			A []byte `bin:"wat"`
+		}{},
+		&struct {
+			A []byte `bin:"endian=little"`
+		}{},
+		&struct {
+			A uint8 `bin:"signed"`
+		}{},
+		&struct {
+			A bool `bin:"signed"`
+		}{},
+		&struct {
+			A float32 `bin:"signed"`
+		}{},
+		&struct {
+			In struct {
+				A    uint8
+				Rest []byte
+			}
+			B uint8
+		}{},
+		&struct {
+			In [2]struct {
+				A    uint8
+				Rest []byte
+			}
+		}{},
+	} {
+		if _, err := SchemaOf(v); err == nil {
+			t.Errorf("%T: expected error", v)
+		}
+	}
+
+	if _, err := SchemaOf(&struct {
+		A bool
+		B []byte `bin:"if=A"`
+	}{}); err != nil {
+		t.Error("conditional []byte field:", err)
+	}
+	if _, err := SchemaOf(&struct {
+		A  uint8
+		In struct {
+			B    uint8
+			Rest []byte
+		}
+	}{}); err != nil {
+		t.Error("nested []byte field:", err)
+	}
+	if _, err := SchemaOf(&struct {
+		A int8 `bin:"bits=4,signed"`
+	}{}); err != nil {
+		t.Error("signed integer field:", err)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Package nbiotcodec provides payload decoders for CBOR and MessagePack. They are
+kept out of the nbiot package so that only programs that use them depend on
+the encoding libraries.
+
+	decoders := nbiot.NewDecoderRegistry()
+	nbiotcodec.Register(decoders) // Enables decoder=cbor and decoder=msgpack
+	decoders.ForPort(1234, nbiotcodec.CBORDecoder)
+	client, err := nbiot.New(nbiot.WithDecoders(decoders))
+*/
+package nbiotcodec
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/telenordigital/nbiot-go"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	// CBORDecoder decodes a CBOR map.
+	CBORDecoder = nbiot.DecoderFunc(decodeCBOR)
+
+	// MessagePackDecoder decodes a MessagePack map.
+	MessagePackDecoder = nbiot.DecoderFunc(decodeMessagePack)
+)
+
+// Register registers the decoders with r under the names "cbor" and
+// "msgpack", for use with nbiot.DecoderTag.
+func Register(r *nbiot.DecoderRegistry) {
+	r.Register("cbor", CBORDecoder)
+	r.Register("msgpack", MessagePackDecoder)
+}
+
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+}.DecMode()
+
+func decodeCBOR(payload []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if err := cborDecMode.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("nbiotcodec: decoding CBOR payload: %v", err)
+	}
+	return fields, nil
+}
+
+func decodeMessagePack(payload []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if err := msgpack.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("nbiotcodec: decoding MessagePack payload: %v", err)
+	}
+	return fields, nil
+}
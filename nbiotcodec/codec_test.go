@@ -0,0 +1,56 @@
+package nbiotcodec
+
+import (
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/telenordigital/nbiot-go"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestDecoders(t *testing.T) {
+	value := map[string]interface{}{"name": "a"}
+	cborPayload, err := cbor.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgpackPayload, err := msgpack.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, test := range map[string]struct {
+		decoder nbiot.Decoder
+		payload []byte
+	}{
+		"cbor":    {CBORDecoder, cborPayload},
+		"msgpack": {MessagePackDecoder, msgpackPayload},
+	} {
+		fields, err := test.decoder.Decode(test.payload)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if fields["name"] != "a" {
+			t.Errorf("%s: got %v", name, fields)
+		}
+		if _, err := test.decoder.Decode([]byte{0xff, 0xff}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := nbiot.NewDecoderRegistry()
+	Register(r)
+	payload, err := cbor.Marshal(map[string]interface{}{"name": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := nbiot.OutputDataMessage{
+		Device:  nbiot.Device{Tags: map[string]string{nbiot.DecoderTag: "cbor"}},
+		Payload: payload,
+	}
+	fields, err := r.Decode(msg)
+	if err != nil || fields["name"] != "a" {
+		t.Fatalf("got %v, %v", fields, err)
+	}
+}
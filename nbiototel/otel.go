@@ -0,0 +1,165 @@
+/*
+Package nbiototel provides OpenTelemetry tracing for the Telenor NB-IoT client.
+
+Pass Instrument to nbiot.New or nbiot.NewWithOptions to get a span for each API
+call and a long-lived span for each output stream, with an event for every
+received message:
+
+	client, err := nbiot.New(nbiototel.Instrument())
+*/
+package nbiototel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/telenordigital/nbiot-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer used by this package.
+const instrumentationName = "github.com/telenordigital/nbiot-go/nbiototel"
+
+// These are the attributes set on spans in addition to the HTTP semantic
+// conventions.
+const (
+	CollectionIDKey = attribute.Key("nbiot.collection.id")
+	DeviceIDKey     = attribute.Key("nbiot.device.id")
+	TransportKey    = attribute.Key("nbiot.transport")
+	PayloadSizeKey  = attribute.Key("nbiot.payload.size")
+)
+
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// Option configures the instrumentation.
+type Option func(*config)
+
+// WithTracerProvider sets the tracer provider. The global provider is used by
+// default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = tp
+	}
+}
+
+// WithPropagator sets the propagator used to inject the trace context into
+// request headers. The global propagator is used by default.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		provider:   otel.GetTracerProvider(),
+		propagator: otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *config) tracer() trace.Tracer {
+	return c.provider.Tracer(instrumentationName)
+}
+
+// Instrument returns a client option that traces both API calls and output
+// streams.
+func Instrument(opts ...Option) nbiot.Option {
+	return func(c *nbiot.Client) {
+		nbiot.WithInterceptors(Interceptor(opts...))(c)
+		nbiot.WithStreamObserver(StreamObserver(opts...))(c)
+	}
+}
+
+// Interceptor returns an interceptor that creates a client span for each API
+// call, including the websocket handshake of output streams.
+func Interceptor(opts ...Option) nbiot.Interceptor {
+	cfg := newConfig(opts)
+	tracer := cfg.tracer()
+	return func(next nbiot.Handler) nbiot.Handler {
+		return func(ctx context.Context, req *nbiot.Request) (*nbiot.Response, error) {
+			ctx, span := tracer.Start(ctx, req.Method+" "+req.Route,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(requestAttributes(req)...))
+			defer span.End()
+
+			cfg.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+			resp, err := next(ctx, req)
+			if resp != nil {
+				span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			} else if resp != nil && resp.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+			}
+			return resp, err
+		}
+	}
+}
+
+// StreamObserver returns a stream observer that creates a span for the
+// lifetime of each output stream with an event for each received message.
+func StreamObserver(opts ...Option) nbiot.StreamObserver {
+	return &streamObserver{newConfig(opts).tracer()}
+}
+
+type streamObserver struct {
+	tracer trace.Tracer
+}
+
+func (o *streamObserver) StreamOpened(ctx context.Context, req *nbiot.Request) nbiot.StreamSession {
+	_, span := o.tracer.Start(ctx, "OutputStream "+req.Route,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(requestAttributes(req)...))
+	return &streamSession{span}
+}
+
+type streamSession struct {
+	span trace.Span
+}
+
+func (s *streamSession) Message(msg nbiot.OutputDataMessage) {
+	s.span.AddEvent("message", trace.WithAttributes(
+		DeviceIDKey.String(msg.Device.ID),
+		TransportKey.String(string(msg.Transport)),
+		PayloadSizeKey.Int(len(msg.Payload)),
+	))
+}
+
+func (s *streamSession) Closed(err error) {
+	if err != nil && !errors.Is(err, io.EOF) && !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+func requestAttributes(req *nbiot.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.HTTPRoute(req.Route),
+	}
+	if req.CollectionID != "" {
+		attrs = append(attrs, CollectionIDKey.String(req.CollectionID))
+	}
+	if req.DeviceID != "" {
+		attrs = append(attrs, DeviceIDKey.String(req.DeviceID))
+	}
+	return attrs
+}
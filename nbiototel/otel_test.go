@@ -0,0 +1,106 @@
+package nbiototel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/telenordigital/nbiot-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Traceparent") == "" {
+			t.Error("no trace context in request to", r.URL.Path)
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/from"):
+			ws, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			ws.WriteJSON(map[string]interface{}{"type": "data", "device": map[string]string{"deviceId": "2"}, "payload": "aGk=", "transport": "udp", "received": "1"})
+			ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			ws.Close()
+		case r.URL.Path == "/collections/1/devices/3":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte(`{"deviceId":"2"}`))
+		}
+	}))
+}
+
+func TestInstrument(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	client, err := nbiot.NewWithOptions(srv.URL, "token", nbiot.WithoutPing(),
+		Instrument(WithTracerProvider(tp), WithPropagator(propagation.TraceContext{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Device("1", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Device("1", "3"); err == nil {
+		t.Fatal("expected error")
+	}
+	stream, err := client.DeviceOutputStream("1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Fatal("expected end of stream")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+
+	ok := spans[0]
+	if ok.Name != "GET /collections/{id}/devices/{id}" {
+		t.Fatal("unexpected name:", ok.Name)
+	}
+	attrs := attribute.NewSet(ok.Attributes...)
+	for key, want := range map[attribute.Key]attribute.Value{
+		"http.request.method":       attribute.StringValue("GET"),
+		"http.route":                attribute.StringValue("/collections/{id}/devices/{id}"),
+		"http.response.status_code": attribute.IntValue(200),
+		CollectionIDKey:             attribute.StringValue("1"),
+		DeviceIDKey:                 attribute.StringValue("2"),
+	} {
+		if v, _ := attrs.Value(key); v != want {
+			t.Errorf("%s = %v; want %v", key, v.Emit(), want.Emit())
+		}
+	}
+
+	if spans[1].Status.Code != codes.Error {
+		t.Error("failed request not marked as error")
+	}
+
+	handshake, session := spans[2], spans[3]
+	if handshake.Name != "GET /collections/{id}/devices/{id}/from" {
+		t.Error("unexpected handshake span:", handshake.Name)
+	}
+	if session.Name != "OutputStream /collections/{id}/devices/{id}/from" || len(session.Events) != 1 {
+		t.Errorf("unexpected session span: %s with %d events", session.Name, len(session.Events))
+	}
+	if session.Status.Code == codes.Error {
+		t.Error("normal close marked as error:", session.Status.Description)
+	}
+}
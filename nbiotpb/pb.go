@@ -0,0 +1,166 @@
+/*
+Package nbiotpb decodes and encodes protobuf payloads with message types loaded
+at run time from a FileDescriptorSet, so that no code has to be generated for
+each schema. A descriptor set can be created with
+
+	protoc --include_imports --descriptor_set_out=fleet.pb fleet.proto
+
+The types plug into an nbiot.DecoderRegistry, mapped to collections, devices or
+ports, or selected by a device's decoder tag:
+
+	types, err := nbiotpb.LoadDescriptorSet("fleet.pb")
+	...
+	decoders := nbiot.NewDecoderRegistry()
+	types.Register(decoders) // Enables e.g. decoder=acme.fleet.Reading
+	d, err := types.Decoder("acme.fleet.Reading")
+	...
+	decoders.ForPort(1234, d)
+	client, err := nbiot.New(nbiot.WithDecoders(decoders))
+
+Decoded fields follow the protobuf JSON mapping: names are lowerCamelCase,
+64-bit integers are strings, bytes are base64 and enums are names.
+*/
+package nbiotpb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/telenordigital/nbiot-go"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Types are the message types of a descriptor set.
+type Types struct {
+	files *protoregistry.Files
+}
+
+// NewTypes returns the message types of a descriptor set. The set must include
+// all imported files.
+func NewTypes(set *descriptorpb.FileDescriptorSet) (*Types, error) {
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("nbiotpb: %v", err)
+	}
+	return &Types{files: files}, nil
+}
+
+// LoadDescriptorSet returns the message types of a binary descriptor set file.
+func LoadDescriptorSet(path string) (*Types, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, set); err != nil {
+		return nil, fmt.Errorf("nbiotpb: reading %s: %v", path, err)
+	}
+	return NewTypes(set)
+}
+
+// Names returns the full names of all message types, including nested ones.
+func (t *Types) Names() []string {
+	var names []string
+	var add func(protoreflect.MessageDescriptors)
+	add = func(msgs protoreflect.MessageDescriptors) {
+		for i := 0; i < msgs.Len(); i++ {
+			if msgs.Get(i).IsMapEntry() {
+				continue
+			}
+			names = append(names, string(msgs.Get(i).FullName()))
+			add(msgs.Get(i).Messages())
+		}
+	}
+	t.files.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		add(f.Messages())
+		return true
+	})
+	return names
+}
+
+func (t *Types) message(name string) (protoreflect.MessageDescriptor, error) {
+	d, err := t.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("nbiotpb: unknown message type %s", name)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("nbiotpb: %s is not a message type", name)
+	}
+	return md, nil
+}
+
+// Decode decodes a payload as the named message type.
+func (t *Types) Decode(name string, payload []byte) (map[string]interface{}, error) {
+	md, err := t.message(name)
+	if err != nil {
+		return nil, err
+	}
+	return decode(md, payload)
+}
+
+func decode(md protoreflect.MessageDescriptor, payload []byte) (map[string]interface{}, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, fmt.Errorf("nbiotpb: decoding %s: %v", md.FullName(), err)
+	}
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("nbiotpb: decoding %s: %v", md.FullName(), err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Encode encodes JSON in the protobuf JSON mapping as the named message type.
+func (t *Types) Encode(name string, data []byte) ([]byte, error) {
+	md, err := t.message(name)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("nbiotpb: encoding %s: %v", name, err)
+	}
+	return proto.Marshal(msg)
+}
+
+// DownstreamMessage returns a message for a device with the JSON data encoded
+// as the named message type.
+func (t *Types) DownstreamMessage(name string, port int, data []byte) (nbiot.DownstreamMessage, error) {
+	payload, err := t.Encode(name, data)
+	if err != nil {
+		return nbiot.DownstreamMessage{}, err
+	}
+	return nbiot.DownstreamMessage{Port: port, Payload: payload}, nil
+}
+
+// Decoder returns a decoder for the named message type.
+func (t *Types) Decoder(name string) (nbiot.Decoder, error) {
+	md, err := t.message(name)
+	if err != nil {
+		return nil, err
+	}
+	return nbiot.DecoderFunc(func(payload []byte) (map[string]interface{}, error) {
+		return decode(md, payload)
+	}), nil
+}
+
+// Register registers a decoder for each message type in r under its full
+// name, so that it can be selected with the device tag nbiot.DecoderTag.
+func (t *Types) Register(r *nbiot.DecoderRegistry) {
+	for _, name := range t.Names() {
+		d, _ := t.Decoder(name)
+		r.Register(name, d)
+	}
+}
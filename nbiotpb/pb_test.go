@@ -0,0 +1,124 @@
+package nbiotpb_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/telenordigital/nbiot-go"
+	"github.com/telenordigital/nbiot-go/nbiotpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// descriptorSet describes
+//
+//	package acme.fleet;
+//	message Reading {
+//		string sensor = 1;
+//		double temperature = 2;
+//		repeated uint32 levels = 3;
+//		Position position = 4;
+//		message Position { sint32 lat = 1; sint32 lon = 2; }
+//	}
+func descriptorSet() *descriptorpb.FileDescriptorSet {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	position := field("position", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional)
+	position.TypeName = proto.String(".acme.fleet.Reading.Position")
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("fleet.proto"),
+		Package: proto.String("acme.fleet"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Reading"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("sensor", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional),
+				field("temperature", 2, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, optional),
+				field("levels", 3, descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_LABEL_REPEATED),
+				position,
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Position"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("lat", 1, descriptorpb.FieldDescriptorProto_TYPE_SINT32, optional),
+					field("lon", 2, descriptorpb.FieldDescriptorProto_TYPE_SINT32, optional),
+				},
+			}},
+		}},
+	}}}
+}
+
+func TestTypes(t *testing.T) {
+	b, err := proto.Marshal(descriptorSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "fleet.pb")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	types, err := nbiotpb.LoadDescriptorSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := types.Names()
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"acme.fleet.Reading", "acme.fleet.Reading.Position"}) {
+		t.Fatal("unexpected names:", names)
+	}
+
+	msg, err := types.DownstreamMessage("acme.fleet.Reading", 1234,
+		[]byte(`{"sensor":"a","temperature":21.5,"levels":[1,2],"position":{"lat":-1,"lon":2}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Port != 1234 {
+		t.Fatal("unexpected port:", msg.Port)
+	}
+
+	fields, err := types.Decode("acme.fleet.Reading", msg.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"sensor":      "a",
+		"temperature": 21.5,
+		"levels":      []interface{}{1.0, 2.0},
+		"position":    map[string]interface{}{"lat": -1.0, "lon": 2.0},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("got %v, want %v", fields, want)
+	}
+
+	decoders := nbiot.NewDecoderRegistry()
+	types.Register(decoders)
+	up := nbiot.OutputDataMessage{
+		Device:  nbiot.Device{Tags: map[string]string{nbiot.DecoderTag: "acme.fleet.Reading.Position"}},
+		Payload: []byte{0x08, 0x01},
+	}
+	if fields, err := decoders.Decode(up); err != nil || fields["lat"] != -1.0 {
+		t.Fatal(err, fields)
+	}
+
+	if _, err := types.Decode("acme.fleet.Reading", []byte{0xff}); err == nil {
+		t.Fatal("expected error for invalid payload")
+	}
+	if _, err := types.Encode("acme.fleet.Reading", []byte(`{"unknown":1}`)); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+	if _, err := types.Decoder("acme.fleet.Missing"); err == nil {
+		t.Fatal("expected error for unknown type")
+	}
+}
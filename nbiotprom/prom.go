@@ -0,0 +1,121 @@
+/*
+Package nbiotprom provides Prometheus metrics for the Telenor NB-IoT client.
+
+	sink := nbiotprom.NewSink()
+	prometheus.MustRegister(sink)
+	client, err := nbiot.New(nbiot.WithMetrics(sink))
+*/
+package nbiotprom
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/telenordigital/nbiot-go"
+)
+
+// namespace is the prefix of all metric names.
+const namespace = "nbiot_client"
+
+// Sink is an nbiot.MetricsSink that records Prometheus metrics. It is a
+// prometheus.Collector and must be registered to be exported.
+type Sink struct {
+	requests   *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	retries    *prometheus.CounterVec
+	bytes      *prometheus.CounterVec
+	streams    prometheus.Gauge
+	messages   *prometheus.CounterVec
+	reconnects *prometheus.CounterVec
+}
+
+// NewSink creates a new sink.
+func NewSink() *Sink {
+	return &Sink{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "API calls by method, route template and status code.",
+		}, []string{"method", "route", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "API call latency including retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "API call retries by method and route template.",
+		}, []string{"method", "route"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_total",
+			Help:      "Request and response body bytes by direction and route template.",
+		}, []string{"direction", "route"}),
+		streams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_streams",
+			Help:      "Output streams currently open.",
+		}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_messages_total",
+			Help:      "Messages received on output streams by collection.",
+		}, []string{"collection"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_reconnects_total",
+			Help:      "Output stream reconnects by collection.",
+		}, []string{"collection"}),
+	}
+}
+
+func (s *Sink) collectors() []prometheus.Collector {
+	return []prometheus.Collector{s.requests, s.latency, s.retries, s.bytes, s.streams, s.messages, s.reconnects}
+}
+
+// Describe implements prometheus.Collector.
+func (s *Sink) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range s.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (s *Sink) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range s.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// RequestDone implements nbiot.MetricsSink.
+func (s *Sink) RequestDone(m nbiot.RequestMetrics) {
+	s.requests.WithLabelValues(m.Method, m.Route, strconv.Itoa(m.StatusCode)).Inc()
+	s.latency.WithLabelValues(m.Method, m.Route).Observe(m.Duration.Seconds())
+	if m.Attempts > 1 {
+		s.retries.WithLabelValues(m.Method, m.Route).Add(float64(m.Attempts - 1))
+	}
+	s.bytes.WithLabelValues("sent", m.Route).Add(float64(m.BytesSent))
+	s.bytes.WithLabelValues("received", m.Route).Add(float64(m.BytesReceived))
+}
+
+// StreamOpened implements nbiot.MetricsSink.
+func (s *Sink) StreamOpened(collectionID string) {
+	s.streams.Inc()
+}
+
+// StreamClosed implements nbiot.MetricsSink.
+func (s *Sink) StreamClosed(collectionID string) {
+	s.streams.Dec()
+}
+
+// MessageReceived implements nbiot.MetricsSink.
+func (s *Sink) MessageReceived(collectionID string, payloadSize int) {
+	s.messages.WithLabelValues(collectionID).Inc()
+}
+
+// StreamReconnected implements nbiot.MetricsSink.
+func (s *Sink) StreamReconnected(collectionID string) {
+	s.reconnects.WithLabelValues(collectionID).Inc()
+}
@@ -0,0 +1,87 @@
+package nbiotprom
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/telenordigital/nbiot-go"
+)
+
+func TestSink(t *testing.T) {
+	var calls int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/from") {
+			ws, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			for i := 0; i < 2; i++ {
+				ws.WriteJSON(map[string]interface{}{"type": "data", "payload": "aGk=", "received": "1"})
+			}
+			ws.ReadMessage()
+			return
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"collectionId":"1"}`))
+	}))
+	defer srv.Close()
+
+	sink := NewSink()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(sink)
+
+	client, err := nbiot.NewWithOptions(srv.URL, "token", nbiot.WithoutPing(),
+		nbiot.WithMetrics(sink),
+		nbiot.WithRetryPolicy(nbiot.Backoff{BaseDelay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Collection("1"); err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(sink.requests.WithLabelValues("GET", "/collections/{id}", "200")); v != 1 {
+		t.Error("unexpected request count:", v)
+	}
+	if v := testutil.ToFloat64(sink.retries.WithLabelValues("GET", "/collections/{id}")); v != 1 {
+		t.Error("unexpected retry count:", v)
+	}
+	if v := testutil.ToFloat64(sink.bytes.WithLabelValues("received", "/collections/{id}")); v != float64(len(`{"collectionId":"1"}`)) {
+		t.Error("unexpected bytes received:", v)
+	}
+
+	stream, err := client.CollectionOutputStream("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(sink.streams); v != 1 {
+		t.Error("unexpected active streams:", v)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream.Close()
+	if v := testutil.ToFloat64(sink.messages.WithLabelValues("1")); v != 2 {
+		t.Error("unexpected message count:", v)
+	}
+	if v := testutil.ToFloat64(sink.streams); v != 0 {
+		t.Error("unexpected active streams:", v)
+	}
+
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+}
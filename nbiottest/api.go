@@ -0,0 +1,958 @@
+package nbiottest
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type team struct {
+	ID      string            `json:"teamId"`
+	Members []member          `json:"members,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+type member struct {
+	UserID        string `json:"userId"`
+	Role          string `json:"role"`
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	VerifiedEmail bool   `json:"verifiedEmail"`
+	VerifiedPhone bool   `json:"verifiedPhone"`
+	AuthType      string `json:"authType,omitempty"`
+}
+
+type invite struct {
+	Code      string `json:"code"`
+	CreatedAt int64  `json:"createdAt"`
+	teamID    string
+}
+
+type fieldMask struct {
+	IMSI     *bool `json:"imsi,omitempty"`
+	IMEI     *bool `json:"imei,omitempty"`
+	Location *bool `json:"location,omitempty"`
+	MSISDN   *bool `json:"msisdn,omitempty"`
+}
+
+type collection struct {
+	ID        string            `json:"collectionId"`
+	TeamID    string            `json:"teamId,omitempty"`
+	FieldMask *fieldMask        `json:"fieldMask,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+type device struct {
+	ID           string            `json:"deviceId"`
+	CollectionID string            `json:"collectionId,omitempty"`
+	IMEI         string            `json:"imei,omitempty"`
+	IMSI         string            `json:"imsi,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+type output struct {
+	ID           string                 `json:"outputId"`
+	CollectionID string                 `json:"collectionId"`
+	Type         string                 `json:"type"`
+	Config       map[string]interface{} `json:"config"`
+	Enabled      bool                   `json:"enabled"`
+	Tags         map[string]string      `json:"tags,omitempty"`
+}
+
+type message struct {
+	Device       device `json:"device"`
+	Payload      []byte `json:"payload"`
+	Received     int64  `json:"received,string"`
+	Transport    string `json:"transport"`
+	CoAPMetaData struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+	} `json:"coapMetaData"`
+	UDPMetaData struct {
+		LocalPort  int `json:"localPort"`
+		RemotePort int `json:"remotePort"`
+	} `json:"udpMetaData"`
+}
+
+// These are the number of messages returned by data queries without a limit,
+// and the most messages returned, as with the real service.
+const (
+	defaultDataLimit = 100
+	maxDataLimit     = 1000
+)
+
+func (s *Server) apiRoutes() []route {
+	return []route{
+		{"GET", "/", s.getRoot},
+		{"GET", "/system", s.getSystem},
+
+		{"GET", "/teams", s.listTeams},
+		{"POST", "/teams", s.createTeam},
+		{"POST", "/teams/accept", s.acceptInvite},
+		{"GET", "/teams/*", s.getTeam},
+		{"PATCH", "/teams/*", s.updateTeam},
+		{"DELETE", "/teams/*", s.deleteTeam},
+		{"DELETE", "/teams/*/tags/*", s.deleteTeamTag},
+		{"PATCH", "/teams/*/members/*", s.updateMember},
+		{"DELETE", "/teams/*/members/*", s.deleteMember},
+		{"GET", "/teams/*/invites", s.listInvites},
+		{"POST", "/teams/*/invites", s.createInvite},
+		{"GET", "/teams/*/invites/*", s.getInvite},
+		{"DELETE", "/teams/*/invites/*", s.deleteInvite},
+
+		{"GET", "/collections", s.listCollections},
+		{"POST", "/collections", s.createCollection},
+		{"GET", "/collections/*", s.getCollection},
+		{"PATCH", "/collections/*", s.updateCollection},
+		{"DELETE", "/collections/*", s.deleteCollection},
+		{"DELETE", "/collections/*/tags/*", s.deleteCollectionTag},
+		{"GET", "/collections/*/data", s.collectionData},
+		{"POST", "/collections/*/to", s.broadcast},
+		{"GET", "/collections/*/from", s.collectionStream},
+
+		{"GET", "/collections/*/devices", s.listDevices},
+		{"POST", "/collections/*/devices", s.createDevice},
+		{"GET", "/collections/*/devices/*", s.getDevice},
+		{"PATCH", "/collections/*/devices/*", s.updateDevice},
+		{"DELETE", "/collections/*/devices/*", s.deleteDevice},
+		{"DELETE", "/collections/*/devices/*/tags/*", s.deleteDeviceTag},
+		{"GET", "/collections/*/devices/*/data", s.deviceData},
+		{"POST", "/collections/*/devices/*/to", s.send},
+		{"GET", "/collections/*/devices/*/from", s.deviceStream},
+
+		{"GET", "/collections/*/outputs", s.listOutputs},
+		{"POST", "/collections/*/outputs", s.createOutput},
+		{"GET", "/collections/*/outputs/*", s.getOutput},
+		{"PATCH", "/collections/*/outputs/*", s.updateOutput},
+		{"DELETE", "/collections/*/outputs/*", s.deleteOutput},
+		{"DELETE", "/collections/*/outputs/*/tags/*", s.deleteOutputTag},
+		{"GET", "/collections/*/outputs/*/logs", s.outputLogs},
+		{"GET", "/collections/*/outputs/*/status", s.outputStatus},
+	}
+}
+
+func (s *Server) getRoot(w http.ResponseWriter, r *http.Request, params []string) {
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func (s *Server) getSystem(w http.ResponseWriter, r *http.Request, params []string) {
+	f := false
+	writeJSON(w, http.StatusOK, map[string]*fieldMask{
+		"defaultFieldMask": {IMSI: &f, IMEI: &f, Location: &f, MSISDN: &f},
+		"forcedFieldMask":  {IMSI: &f, IMEI: &f, Location: &f, MSISDN: &f},
+	})
+}
+
+// Teams
+
+func (s *Server) listTeams(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	teams := []team{}
+	for _, id := range sortedIDs(s.teams) {
+		teams = append(teams, *s.teams[id])
+	}
+	writeJSON(w, http.StatusOK, map[string][]team{"teams": teams})
+}
+
+func (s *Server) createTeam(w http.ResponseWriter, r *http.Request, params []string) {
+	var t team
+	if !readJSON(w, r, &t) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t = team{
+		ID:      s.newID(),
+		Members: []member{{UserID: userID, Role: "admin", Name: "Test User", AuthType: "token"}},
+		Tags:    copyTags(t.Tags),
+	}
+	s.teams[t.ID] = &t
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[params[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) updateTeam(w http.ResponseWriter, r *http.Request, params []string) {
+	var update team
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[params[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	t.Tags = mergeTags(t.Tags, update.Tags)
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) deleteTeam(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	delete(s.teams, params[0])
+	for code, iv := range s.invites {
+		if iv.teamID == params[0] {
+			delete(s.invites, code)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteTeamTag(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[params[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	delete(t.Tags, params[1])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) updateMember(w http.ResponseWriter, r *http.Request, params []string) {
+	var update member
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[params[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	for i := range t.Members {
+		if t.Members[i].UserID == params[1] {
+			if update.Role != "" {
+				t.Members[i].Role = update.Role
+			}
+			writeJSON(w, http.StatusOK, t.Members[i])
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Member not found")
+}
+
+func (s *Server) deleteMember(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[params[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	for i := range t.Members {
+		if t.Members[i].UserID == params[1] {
+			t.Members = append(t.Members[:i], t.Members[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Member not found")
+}
+
+// Invites
+
+func (s *Server) listInvites(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	invites := []invite{}
+	for _, code := range sortedIDs(s.invites) {
+		if iv := s.invites[code]; iv.teamID == params[0] {
+			invites = append(invites, *iv)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string][]invite{"invites": invites})
+}
+
+func (s *Server) createInvite(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	iv := &invite{
+		Code:      "invite-" + s.newID(),
+		CreatedAt: time.Now().UnixNano() / int64(time.Millisecond),
+		teamID:    params[0],
+	}
+	s.invites[iv.Code] = iv
+	writeJSON(w, http.StatusCreated, iv)
+}
+
+func (s *Server) getInvite(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	iv, ok := s.invites[params[1]]
+	if !ok || iv.teamID != params[0] {
+		writeError(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, iv)
+}
+
+func (s *Server) deleteInvite(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	iv, ok := s.invites[params[1]]
+	if !ok || iv.teamID != params[0] {
+		writeError(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+	delete(s.invites, params[1])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) acceptInvite(w http.ResponseWriter, r *http.Request, params []string) {
+	var accept invite
+	if !readJSON(w, r, &accept) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	iv, ok := s.invites[accept.Code]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+	t := s.teams[iv.teamID]
+	for _, m := range t.Members {
+		if m.UserID == userID {
+			writeError(w, http.StatusConflict, "Already a member of the team")
+			return
+		}
+	}
+	t.Members = append(t.Members, member{UserID: userID, Role: "member"})
+	delete(s.invites, accept.Code)
+	writeJSON(w, http.StatusOK, t)
+}
+
+// Collections
+
+func (s *Server) listCollections(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	collections := []collection{}
+	for _, id := range sortedIDs(s.collections) {
+		collections = append(collections, *s.collections[id])
+	}
+	writeJSON(w, http.StatusOK, map[string][]collection{"collections": collections})
+}
+
+func (s *Server) createCollection(w http.ResponseWriter, r *http.Request, params []string) {
+	var c collection
+	if !readJSON(w, r, &c) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.TeamID == "" {
+		c.TeamID = s.defaultTeam()
+	} else if _, ok := s.teams[c.TeamID]; !ok {
+		writeError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	c.ID = s.newID()
+	c.Tags = copyTags(c.Tags)
+	s.collections[c.ID] = &c
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// defaultTeam returns the ID of the team new collections belong to, creating
+// it if necessary. s.mu must be held.
+func (s *Server) defaultTeam() string {
+	for _, id := range sortedIDs(s.teams) {
+		return id
+	}
+	t := &team{
+		ID:      s.newID(),
+		Members: []member{{UserID: userID, Role: "admin", Name: "Test User", AuthType: "token"}},
+	}
+	s.teams[t.ID] = t
+	return t.ID
+}
+
+func (s *Server) getCollection(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.collections[params[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) updateCollection(w http.ResponseWriter, r *http.Request, params []string) {
+	var update collection
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.collections[params[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	if update.TeamID != "" {
+		if _, ok := s.teams[update.TeamID]; !ok {
+			writeError(w, http.StatusNotFound, "Team not found")
+			return
+		}
+		c.TeamID = update.TeamID
+	}
+	if update.FieldMask != nil {
+		c.FieldMask = update.FieldMask
+	}
+	c.Tags = mergeTags(c.Tags, update.Tags)
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) deleteCollection(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	delete(s.collections, params[0])
+	for id, d := range s.devices {
+		if d.CollectionID == params[0] {
+			delete(s.devices, id)
+		}
+	}
+	for id, o := range s.outputs {
+		if o.CollectionID == params[0] {
+			delete(s.outputs, id)
+		}
+	}
+	data := s.data[:0]
+	for _, m := range s.data {
+		if m.Device.CollectionID != params[0] {
+			data = append(data, m)
+		}
+	}
+	s.data = data
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteCollectionTag(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.collections[params[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	delete(c.Tags, params[1])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Devices
+
+// device returns the device in the collection. It writes an error response
+// and returns nil if either doesn't exist. s.mu must be held.
+func (s *Server) device(w http.ResponseWriter, collectionID, deviceID string) *device {
+	if _, ok := s.collections[collectionID]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return nil
+	}
+	d, ok := s.devices[deviceID]
+	if !ok || d.CollectionID != collectionID {
+		writeError(w, http.StatusNotFound, "Device not found")
+		return nil
+	}
+	return d
+}
+
+// conflictingDevice reports whether another device has the IMSI or IMEI of
+// d. s.mu must be held.
+func (s *Server) conflictingDevice(d *device) bool {
+	for _, other := range s.devices {
+		if other.ID != d.ID && ((d.IMSI != "" && other.IMSI == d.IMSI) || (d.IMEI != "" && other.IMEI == d.IMEI)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	devices := []device{}
+	for _, id := range sortedIDs(s.devices) {
+		if d := s.devices[id]; d.CollectionID == params[0] {
+			devices = append(devices, *d)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string][]device{"devices": devices})
+}
+
+func (s *Server) createDevice(w http.ResponseWriter, r *http.Request, params []string) {
+	var d device
+	if !readJSON(w, r, &d) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	d.ID = s.newID()
+	d.CollectionID = params[0]
+	d.Tags = copyTags(d.Tags)
+	if s.conflictingDevice(&d) {
+		writeError(w, http.StatusConflict, "A device with the same IMSI or IMEI already exists")
+		return
+	}
+	s.devices[d.ID] = &d
+	writeJSON(w, http.StatusCreated, d)
+}
+
+func (s *Server) getDevice(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.device(w, params[0], params[1]); d != nil {
+		writeJSON(w, http.StatusOK, d)
+	}
+}
+
+func (s *Server) updateDevice(w http.ResponseWriter, r *http.Request, params []string) {
+	var update device
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.device(w, params[0], params[1])
+	if d == nil {
+		return
+	}
+	updated := *d
+	if update.IMSI != "" {
+		updated.IMSI = update.IMSI
+	}
+	if update.IMEI != "" {
+		updated.IMEI = update.IMEI
+	}
+	if s.conflictingDevice(&updated) {
+		writeError(w, http.StatusConflict, "A device with the same IMSI or IMEI already exists")
+		return
+	}
+	updated.Tags = mergeTags(d.Tags, update.Tags)
+	*d = updated
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Server) deleteDevice(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.device(w, params[0], params[1]); d != nil {
+		delete(s.devices, d.ID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) deleteDeviceTag(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.device(w, params[0], params[1]); d != nil {
+		delete(d.Tags, params[2])
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Outputs
+
+// output returns the output in the collection. It writes an error response
+// and returns nil if either doesn't exist. s.mu must be held.
+func (s *Server) output(w http.ResponseWriter, collectionID, outputID string) *output {
+	if _, ok := s.collections[collectionID]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return nil
+	}
+	o, ok := s.outputs[outputID]
+	if !ok || o.CollectionID != collectionID {
+		writeError(w, http.StatusNotFound, "Output not found")
+		return nil
+	}
+	return o
+}
+
+func validOutputType(typ string) bool {
+	switch typ {
+	case "webhook", "mqtt", "ifttt", "udp":
+		return true
+	}
+	return false
+}
+
+func (s *Server) listOutputs(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	outputs := []output{}
+	for _, id := range sortedIDs(s.outputs) {
+		if o := s.outputs[id]; o.CollectionID == params[0] {
+			outputs = append(outputs, *o)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string][]output{"outputs": outputs})
+}
+
+func (s *Server) createOutput(w http.ResponseWriter, r *http.Request, params []string) {
+	var o output
+	if !readJSON(w, r, &o) {
+		return
+	}
+	if !validOutputType(o.Type) {
+		writeError(w, http.StatusBadRequest, "Unknown output type "+strconv.Quote(o.Type))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	o.ID = s.newID()
+	o.CollectionID = params[0]
+	o.Tags = copyTags(o.Tags)
+	s.outputs[o.ID] = &o
+	writeJSON(w, http.StatusCreated, o)
+}
+
+func (s *Server) getOutput(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o := s.output(w, params[0], params[1]); o != nil {
+		writeJSON(w, http.StatusOK, o)
+	}
+}
+
+func (s *Server) updateOutput(w http.ResponseWriter, r *http.Request, params []string) {
+	var update struct {
+		Type    string                 `json:"type"`
+		Config  map[string]interface{} `json:"config"`
+		Enabled *bool                  `json:"enabled"`
+		Tags    map[string]string      `json:"tags"`
+	}
+	if !readJSON(w, r, &update) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.output(w, params[0], params[1])
+	if o == nil {
+		return
+	}
+	if update.Type != "" && update.Type != o.Type {
+		writeError(w, http.StatusBadRequest, "The output type can't be changed")
+		return
+	}
+	for k, v := range update.Config {
+		o.Config[k] = v
+	}
+	if update.Enabled != nil {
+		o.Enabled = *update.Enabled
+	}
+	o.Tags = mergeTags(o.Tags, update.Tags)
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *Server) deleteOutput(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o := s.output(w, params[0], params[1]); o != nil {
+		delete(s.outputs, o.ID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) deleteOutputTag(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o := s.output(w, params[0], params[1]); o != nil {
+		delete(o.Tags, params[2])
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) outputLogs(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o := s.output(w, params[0], params[1]); o != nil {
+		writeJSON(w, http.StatusOK, map[string][]interface{}{"logs": {}})
+	}
+}
+
+func (s *Server) outputStatus(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o := s.output(w, params[0], params[1]); o != nil {
+		writeJSON(w, http.StatusOK, map[string]int{
+			"errorCount": 0,
+			"forwarded":  0,
+			"received":   0,
+			"retries":    0,
+		})
+	}
+}
+
+// Data
+
+func (s *Server) collectionData(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	s.writeData(w, r, params[0], "")
+}
+
+func (s *Server) deviceData(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.device(w, params[0], params[1]); d != nil {
+		s.writeData(w, r, params[0], params[1])
+	}
+}
+
+// writeData writes the stored messages matching the query, newest first.
+// The since and until parameters are inclusive. s.mu must be held.
+func (s *Server) writeData(w http.ResponseWriter, r *http.Request, collectionID, deviceID string) {
+	q := r.URL.Query()
+	var since, until, limit int64
+	for name, v := range map[string]*int64{"since": &since, "until": &until, "limit": &limit} {
+		if q.Get(name) == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(q.Get(name), 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid "+name+" parameter")
+			return
+		}
+		*v = n
+	}
+	if limit == 0 {
+		limit = defaultDataLimit
+	}
+	limit = min(limit, maxDataLimit)
+
+	messages := []message{}
+	for i := len(s.data) - 1; i >= 0 && int64(len(messages)) < limit; i-- {
+		m := s.data[i]
+		if m.Device.CollectionID != collectionID || (deviceID != "" && m.Device.ID != deviceID) {
+			continue
+		}
+		if (since != 0 && m.Received < since) || (until != 0 && m.Received > until) {
+			continue
+		}
+		messages = append(messages, *m)
+	}
+	writeJSON(w, http.StatusOK, map[string][]message{"messages": messages})
+}
+
+// Downstream
+
+func (s *Server) send(w http.ResponseWriter, r *http.Request, params []string) {
+	var msg downstream
+	if !readJSON(w, r, &msg) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.device(w, params[0], params[1])
+	if d == nil {
+		return
+	}
+	if err := s.deliver(d, msg, false); err != "" {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) broadcast(w http.ResponseWriter, r *http.Request, params []string) {
+	var msg downstream
+	if !readJSON(w, r, &msg) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[params[0]]; !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+
+	type broadcastError struct {
+		DeviceID string `json:"deviceId"`
+		Message  string `json:"message"`
+	}
+	result := struct {
+		Sent   int              `json:"sent"`
+		Failed int              `json:"failed"`
+		Errors []broadcastError `json:"errors"`
+	}{Errors: []broadcastError{}}
+	for _, id := range sortedIDs(s.devices) {
+		d := s.devices[id]
+		if d.CollectionID != params[0] {
+			continue
+		}
+		if err := s.deliver(d, msg, true); err != "" {
+			result.Failed++
+			result.Errors = append(result.Errors, broadcastError{d.ID, err})
+			continue
+		}
+		result.Sent++
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+type downstream struct {
+	Port      int    `json:"port"`
+	Payload   []byte `json:"payload"`
+	Path      string `json:"coapPath,omitempty"`
+	Transport string `json:"transport,omitempty"`
+}
+
+// deliver sends a message to a device. It returns an error message if the
+// message can't be delivered. s.mu must be held.
+func (s *Server) deliver(d *device, msg downstream, broadcast bool) string {
+	// Like the real service, messages can only be sent to devices that
+	// have sent something, since that is how their address is known.
+	if !s.reachable[d.ID] {
+		return "The device has no known address"
+	}
+	s.sent = append(s.sent, Downstream{
+		CollectionID: d.CollectionID,
+		DeviceID:     d.ID,
+		Port:         msg.Port,
+		Payload:      msg.Payload,
+		Path:         msg.Path,
+		Transport:    msg.Transport,
+		Broadcast:    broadcast,
+	})
+	return ""
+}
+
+// Output streams
+
+// stream is a websocket subscribed to the messages of a collection or device.
+type stream struct {
+	mu           sync.Mutex // Serializes writes
+	ws           *websocket.Conn
+	collectionID string
+	deviceID     string
+}
+
+func (s *Server) collectionStream(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	_, ok := s.collections[params[0]]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	s.serveStream(w, r, params[0], "")
+}
+
+func (s *Server) deviceStream(w http.ResponseWriter, r *http.Request, params []string) {
+	s.mu.Lock()
+	d := s.device(w, params[0], params[1])
+	s.mu.Unlock()
+	if d != nil {
+		s.serveStream(w, r, params[0], params[1])
+	}
+}
+
+// serveStream upgrades the request to a websocket and keeps it subscribed
+// until the client goes away.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, collectionID, deviceID string) {
+	// The stream is registered before the handshake response can reach the
+	// client so that messages injected right after the stream was opened
+	// aren't lost.
+	s.mu.Lock()
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.mu.Unlock()
+		return
+	}
+	st := &stream{ws: ws, collectionID: collectionID, deviceID: deviceID}
+	s.streams[st] = true
+	s.mu.Unlock()
+	ws.SetPingHandler(func(data string) error {
+		s.mu.Lock()
+		stalled := s.stalled
+		s.mu.Unlock()
+		if stalled {
+			return nil
+		}
+		return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, st)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// write sends a frame to the stream's client.
+func (st *stream) write(v interface{}) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.ws.WriteJSON(v)
+}
+
+// sortedIDs returns the keys of a resource map in order of creation.
+func sortedIDs[T any](m map[string]T) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,447 @@
+/*
+Package cassette records exchanges with the Telenor NB-IoT API to a file and
+replays them in later test runs, so tests recorded once against the live
+service can run without network access or an API token.
+
+A Recorder is a local HTTP server that sits between the client and the API.
+It handles both REST requests and the websockets of output streams:
+
+	mode := cassette.Replay
+	if os.Getenv("NBIOT_RECORD") != "" {
+		mode = cassette.Record
+	}
+	rec, err := cassette.New("testdata/devices.json", mode, nbiot.DefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rec.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	client, err := nbiot.NewWithAddr(rec.URL, token)
+
+Requests are matched by method, path and body. API tokens are never recorded
+and output secrets are redacted from bodies.
+*/
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/telenordigital/nbiot-go/internal/redact"
+)
+
+// Mode is the mode of a Recorder.
+type Mode int
+
+// These are the recorder modes.
+const (
+	// Replay serves recorded interactions from the cassette.
+	Replay Mode = iota
+
+	// Record forwards requests to the API and records the interactions.
+	Record
+)
+
+// ErrMissing is returned by Close in strict mode when requests were missing
+// from the cassette.
+var ErrMissing = errors.New("cassette: requests missing")
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+	Frames   []string `json:"frames,omitempty"` // Websocket frames sent by the API
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"` // Including any query string
+	Body   string `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// recordedHeaders are the response headers stored in cassettes.
+var recordedHeaders = []string{"Content-Type", "Retry-After", "X-Request-Id"}
+
+// Recorder records or replays interactions with the API.
+type Recorder struct {
+	URL string // The address clients should use instead of the API's
+
+	file     string
+	mode     Mode
+	upstream string
+	strict   bool
+	srv      *httptest.Server
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     map[*Interaction]bool
+	dirty    bool
+	missing  []string
+	streams  map[*websocket.Conn]bool // Client connections of output streams
+	closing  bool
+	wg       sync.WaitGroup // Output stream handlers
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// Strict makes a replaying recorder fail requests that aren't in the
+// cassette, and report them as an error from Close. By default such requests
+// are forwarded to the upstream API, if one is given, and added to the
+// cassette.
+func Strict() Option {
+	return func(r *Recorder) {
+		r.strict = true
+	}
+}
+
+// New creates a recorder for the cassette in file. In Record mode requests
+// are forwarded to upstream, the address of the API, and the cassette is
+// written by Close. In Replay mode the file must exist.
+func New(file string, mode Mode, upstream string, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		file:     file,
+		mode:     mode,
+		upstream: strings.TrimSuffix(upstream, "/"),
+		used:     make(map[*Interaction]bool),
+		streams:  make(map[*websocket.Conn]bool),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if mode == Replay {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(buf, &r.cassette); err != nil {
+			return nil, fmt.Errorf("cassette: %s: %v", file, err)
+		}
+	}
+
+	r.srv = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	r.URL = r.srv.URL
+	return r, nil
+}
+
+// Close shuts down the recorder. In Record mode, and in Replay mode when new
+// interactions were recorded, it writes the cassette. In strict Replay mode
+// it returns an error if any request was missing from the cassette.
+func (r *Recorder) Close() error {
+	// The server doesn't close or wait for hijacked connections, so output
+	// streams are closed here and waited for, so that no frames are added
+	// while the cassette is written.
+	r.mu.Lock()
+	r.closing = true
+	for ws := range r.streams {
+		ws.Close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	r.srv.CloseClientConnections()
+	r.srv.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.missing) > 0 {
+		return fmt.Errorf("%w from %s: %s", ErrMissing, r.file, strings.Join(r.missing, ", "))
+	}
+	if r.mode == Record || r.dirty {
+		return r.save()
+	}
+	return nil
+}
+
+// save writes the cassette. r.mu must be held.
+func (r *Recorder) save() error {
+	buf, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.file, append(buf, '\n'), 0644)
+}
+
+func (r *Recorder) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recorded := Request{
+		Method: req.Method,
+		Path:   req.URL.RequestURI(),
+		Body:   normalizeBody(body),
+	}
+
+	if r.mode == Replay {
+		if in := r.find(recorded); in != nil {
+			r.replay(w, req, in)
+			return
+		}
+		if r.strict || r.upstream == "" {
+			r.mu.Lock()
+			if r.strict {
+				r.missing = append(r.missing, recorded.Method+" "+recorded.Path)
+			}
+			r.mu.Unlock()
+			writeError(w, http.StatusNotImplemented, "cassette: no recorded interaction for "+recorded.Method+" "+recorded.Path)
+			return
+		}
+	}
+
+	in := &Interaction{Request: recorded}
+	if websocket.IsWebSocketUpgrade(req) {
+		r.recordStream(w, req, in)
+		return
+	}
+	r.record(w, req, body, in)
+}
+
+// find returns the first unused interaction matching req. In non-strict mode
+// the last matching interaction is reused when all have been used.
+func (r *Recorder) find(req Request) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last *Interaction
+	for _, in := range r.cassette.Interactions {
+		if in.Request != req {
+			continue
+		}
+		if !r.used[in] {
+			r.used[in] = true
+			return in
+		}
+		last = in
+	}
+	if r.strict {
+		return nil
+	}
+	return last
+}
+
+// track registers the client connection of an output stream so that Close
+// can close it. It reports false if the recorder is closing. Handlers that
+// tracked a connection must call untrack when they return.
+func (r *Recorder) track(ws *websocket.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closing {
+		return false
+	}
+	r.streams[ws] = true
+	r.wg.Add(1)
+	return true
+}
+
+func (r *Recorder) untrack(ws *websocket.Conn) {
+	r.mu.Lock()
+	delete(r.streams, ws)
+	r.mu.Unlock()
+	r.wg.Done()
+}
+
+// add adds a recorded interaction to the cassette.
+func (r *Recorder) add(in *Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	r.used[in] = true
+	r.dirty = true
+}
+
+func (r *Recorder) replay(w http.ResponseWriter, req *http.Request, in *Interaction) {
+	if websocket.IsWebSocketUpgrade(req) && in.Response.StatusCode == http.StatusSwitchingProtocols {
+		ws, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		if !r.track(ws) {
+			return
+		}
+		defer r.untrack(ws)
+		for _, frame := range in.Frames {
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+				return
+			}
+		}
+		// Keep the stream open until the client closes it.
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+	writeResponse(w, in.Response)
+}
+
+func (r *Recorder) record(w http.ResponseWriter, req *http.Request, body []byte, in *Interaction) {
+	up, err := http.NewRequestWithContext(req.Context(), req.Method, r.upstream+req.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	up.Header = req.Header.Clone()
+	resp, err := http.DefaultClient.Do(up)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	in.Response = Response{
+		StatusCode: resp.StatusCode,
+		Header:     filterHeader(resp.Header),
+		Body:       normalizeBody(respBody),
+	}
+	r.add(in)
+
+	// The client gets the unredacted response.
+	copyHeader(w.Header(), in.Response.Header)
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+}
+
+func (r *Recorder) recordStream(w http.ResponseWriter, req *http.Request, in *Interaction) {
+	urlStr := "ws" + strings.TrimPrefix(r.upstream, "http") + req.URL.RequestURI()
+	header := http.Header{}
+	for _, k := range []string{"X-Api-Token", "User-Agent", "Traceparent", "Tracestate"} {
+		if v, ok := req.Header[k]; ok {
+			header[k] = v
+		}
+	}
+	upstream, resp, err := websocket.DefaultDialer.DialContext(req.Context(), urlStr, header)
+	if err != nil {
+		if resp == nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		in.Response = Response{
+			StatusCode: resp.StatusCode,
+			Header:     filterHeader(resp.Header),
+			Body:       normalizeBody(body),
+		}
+		r.add(in)
+		writeResponse(w, in.Response)
+		return
+	}
+	defer upstream.Close()
+
+	ws, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	if !r.track(ws) {
+		return
+	}
+	defer r.untrack(ws)
+	in.Response = Response{StatusCode: http.StatusSwitchingProtocols}
+	r.add(in)
+
+	// Close the upstream connection when the client goes away.
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				upstream.Close()
+				return
+			}
+		}
+	}()
+	for {
+		typ, frame, err := upstream.ReadMessage()
+		if err != nil {
+			return
+		}
+		if typ == websocket.TextMessage {
+			r.mu.Lock()
+			in.Frames = append(in.Frames, string(frame))
+			r.mu.Unlock()
+		}
+		if err := ws.WriteMessage(typ, frame); err != nil {
+			return
+		}
+	}
+}
+
+var upgrader = websocket.Upgrader{}
+
+func filterHeader(h http.Header) http.Header {
+	filtered := http.Header{}
+	for _, k := range recordedHeaders {
+		if v, ok := h[k]; ok {
+			filtered[k] = v
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	return filtered
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+func writeResponse(w http.ResponseWriter, resp Response) {
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	io.WriteString(w, resp.Body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "message": message})
+}
+
+// normalizeBody returns a JSON body in canonical form with output secrets
+// redacted, so that bodies can be compared. Other bodies are returned as is.
+func normalizeBody(body []byte) string {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil || dec.Decode(new(interface{})) != io.EOF {
+		return string(body)
+	}
+	redact.Config(v)
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(buf)
+}
@@ -0,0 +1,178 @@
+package cassette
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/telenordigital/nbiot-go"
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func TestRecordReplay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cassette.json")
+
+	srv := nbiottest.NewServer()
+	rec, err := New(file, Record, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := nbiot.NewWithAddr(rec.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(nbiot.Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateOutput(collection.ID, nbiot.WebHookOutput{URL: "http://example.com", BasicAuthPass: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Device(collection.ID, "unknown"); !errors.Is(err, nbiot.ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), "secret") || strings.Contains(string(buf), srv.Token) {
+		t.Fatal("secrets recorded:", string(buf))
+	}
+
+	// Replay without the server and with another token.
+	rec, err = New(file, Replay, "", Strict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err = nbiot.NewWithAddr(rec.URL, "other token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := client.CreateCollection(nbiot.Collection{})
+	if err != nil || replayed.ID != collection.ID {
+		t.Fatal(err, replayed)
+	}
+	if _, err := client.CreateOutput(collection.ID, nbiot.WebHookOutput{URL: "http://example.com", BasicAuthPass: "other secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Device(collection.ID, "unknown"); !errors.Is(err, nbiot.ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictMissing(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cassette.json")
+	if err := os.WriteFile(file, []byte(`{"interactions":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := New(file, Replay, "", Strict())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := nbiot.NewWithOptions(rec.URL, "token", nbiot.WithoutPing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Collections(); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := rec.Close(); !errors.Is(err, ErrMissing) || !strings.Contains(err.Error(), "GET /collections") {
+		t.Fatal("expected ErrMissing, got", err)
+	}
+}
+
+func TestRecordStream(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"data","payload":"aGk=","received":"1"}`))
+		ws.ReadMessage()
+	}))
+	defer upstream.Close()
+
+	file := filepath.Join(t.TempDir(), "cassette.json")
+	for _, mode := range []Mode{Record, Replay} {
+		rec, err := New(file, mode, upstream.URL, Strict())
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := nbiot.NewWithOptions(rec.URL, "token", nbiot.WithoutPing())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream, err := client.CollectionOutputStream("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := stream.Recv()
+		if err != nil || string(msg.Payload) != "hi" {
+			t.Fatal(err, msg)
+		}
+		stream.Close()
+		if err := rec.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCloseWithOpenStream(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"data","payload":"aGk=","received":"1"}`))
+		ws.ReadMessage()
+	}))
+	defer upstream.Close()
+
+	file := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := New(file, Record, upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := nbiot.NewWithOptions(rec.URL, "token", nbiot.WithoutPing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CollectionOutputStream("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the recorder ends the stream, which was recorded in full.
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-stream.Done()
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), "aGk=") {
+		t.Fatalf("frame not recorded: %s", buf)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Package nbiottest provides an in-memory fake of the Telenor NB-IoT API for
+tests that shouldn't depend on the live service.
+
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := nbiot.NewWithAddr(srv.URL, srv.Token)
+
+The server implements the parts of the REST API used by the client, including
+the websocket output streams, and keeps all state in memory.
+
+Use Inject to simulate messages from devices and Sent to inspect the messages
+sent to them:
+
+	srv.Inject(collectionID, deviceID, nbiottest.Message{Payload: []byte("hello")})
+	...
+	for _, msg := range srv.Sent() {
+		...
+	}
+*/
+package nbiottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Token is the API token accepted by servers created by NewServer.
+const Token = "nbiottest-token"
+
+// userID is the ID of the user that owns Token.
+const userID = "nbiottest-user"
+
+// Server is a fake NB-IoT API server.
+type Server struct {
+	URL   string // The base URL of the server, e.g. http://127.0.0.1:1234
+	Token string // The API token accepted by the server
+
+	srv    *httptest.Server
+	routes []route
+
+	mu          sync.Mutex
+	nextID      int
+	teams       map[string]*team
+	invites     map[string]*invite // by code
+	collections map[string]*collection
+	devices     map[string]*device
+	outputs     map[string]*output
+	data        []*message
+	streams     map[*stream]bool
+	reachable   map[string]bool // Devices that have sent upstream messages
+	sent        []Downstream
+	stalled     bool // Whether streams have stopped answering pings
+}
+
+// NewServer starts a new server. The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		Token:       Token,
+		teams:       make(map[string]*team),
+		invites:     make(map[string]*invite),
+		collections: make(map[string]*collection),
+		devices:     make(map[string]*device),
+		outputs:     make(map[string]*output),
+		streams:     make(map[*stream]bool),
+		reachable:   make(map[string]bool),
+	}
+	s.routes = s.apiRoutes()
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close closes all output streams and shuts down the server.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for st := range s.streams {
+		st.ws.Close()
+	}
+	s.mu.Unlock()
+	s.srv.Close()
+}
+
+// newID returns a new unique resource ID. s.mu must be held.
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("17dh0cf43j%06x", s.nextID)
+}
+
+// route is an API endpoint. A "*" in the pattern matches any path segment.
+type route struct {
+	method  string
+	pattern string
+	handler func(w http.ResponseWriter, r *http.Request, params []string)
+}
+
+func (rt route) match(method, path string) ([]string, bool) {
+	if method != rt.method {
+		return nil, false
+	}
+	want := strings.Split(rt.pattern, "/")
+	got := strings.Split(path, "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+	var params []string
+	for i := range want {
+		switch {
+		case want[i] == "*" && got[i] != "":
+			params = append(params, got[i])
+		case want[i] != got[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-API-Token") != s.Token {
+		writeError(w, http.StatusUnauthorized, "Invalid API token")
+		return
+	}
+
+	pathMatched := false
+	for _, rt := range s.routes {
+		if _, ok := rt.match(rt.method, r.URL.Path); ok {
+			pathMatched = true
+		}
+		if params, ok := rt.match(r.Method, r.URL.Path); ok {
+			rt.handler(w, r, params)
+			return
+		}
+	}
+	if pathMatched {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	writeError(w, http.StatusNotFound, "Not found")
+}
+
+// writeJSON writes v as the response body.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response in the same format as the API.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"status":  status,
+		"message": message,
+	})
+}
+
+// readJSON decodes the request body into v. It writes an error response and
+// returns false if the body is invalid.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// mergeTags adds or updates the tags in update.
+func mergeTags(tags, update map[string]string) map[string]string {
+	if len(update) == 0 {
+		return tags
+	}
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	for k, v := range update {
+		tags[k] = v
+	}
+	return tags
+}
+
+// copyTags returns a copy of tags, or nil if there are none.
+func copyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(tags))
+	for k, v := range tags {
+		c[k] = v
+	}
+	return c
+}
+
+var upgrader = websocket.Upgrader{}
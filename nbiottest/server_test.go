@@ -0,0 +1,173 @@
+package nbiottest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/telenordigital/nbiot-go"
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func TestServer(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	if _, err := nbiot.NewWithAddr(srv.URL, "wrong token"); !errors.Is(err, nbiot.ErrUnauthorized) {
+		t.Fatal("expected ErrUnauthorized, got", err)
+	}
+
+	client, err := nbiot.NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection, err := client.CreateCollection(nbiot.Collection{Tags: map[string]string{"name": "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collection.ID == "" || collection.TeamID == "" {
+		t.Fatal("unexpected collection:", collection)
+	}
+
+	device, err := client.CreateDevice(collection.ID, nbiot.Device{IMSI: "1", IMEI: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateDevice(collection.ID, nbiot.Device{IMSI: "1", IMEI: "3"}); !errors.Is(err, nbiot.ErrConflict) {
+		t.Fatal("expected ErrConflict, got", err)
+	}
+	device.Tags = map[string]string{"a": "1", "b": "2"}
+	if _, err := client.UpdateDevice(collection.ID, device); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteDeviceTag(collection.ID, device.ID, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if device, err = client.Device(collection.ID, device.ID); err != nil || len(device.Tags) != 1 || device.Tags["b"] != "2" {
+		t.Fatal(err, device)
+	}
+
+	output, err := client.CreateOutput(collection.ID, nbiot.MQTTOutput{Endpoint: "mqtt://example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mqtt := output.(nbiot.MQTTOutput)
+	mqtt.Disabled = true
+	mqtt.TopicName = "topic"
+	if output, err = client.UpdateOutput(collection.ID, mqtt); err != nil {
+		t.Fatal(err)
+	}
+	if mqtt = output.(nbiot.MQTTOutput); !mqtt.Disabled || mqtt.TopicName != "topic" || mqtt.Password != "secret" {
+		t.Fatal("unexpected output:", mqtt)
+	}
+	if outputs, err := client.Outputs(collection.ID); err != nil || len(outputs) != 1 {
+		t.Fatal(err, outputs)
+	}
+
+	team, err := client.Team(collection.TeamID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(team.Members) != 1 {
+		t.Fatal("unexpected members:", team.Members)
+	}
+	if m, err := client.UpdateTeamMemberRole(team.ID, team.Members[0].UserID, "member"); err != nil || m.Role != "member" {
+		t.Fatal(err, m)
+	}
+
+	stream, err := client.DeviceOutputStream(collection.ID, device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	if _, err := client.DeviceOutputStream(collection.ID, "unknown"); err == nil {
+		t.Fatal("expected error for unknown device")
+	}
+
+	if err := client.DeleteCollection(collection.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Device(collection.ID, device.ID); !errors.Is(err, nbiot.ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+}
+
+func TestTraffic(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := nbiot.NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(nbiot.Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, nbiot.Device{IMSI: "1", IMEI: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := nbiot.DownstreamMessage{Port: 1234, Payload: []byte("down")}
+	if err := client.Send(collection.ID, device.ID, msg); !errors.Is(err, nbiot.ErrConflict) {
+		t.Fatal("expected ErrConflict before the device has sent anything, got", err)
+	}
+
+	if err := srv.Inject(collection.ID, "unknown", nbiottest.Message{}); err == nil {
+		t.Fatal("expected error for unknown device")
+	}
+
+	deviceStream, err := client.DeviceOutputStream(collection.ID, device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deviceStream.Close()
+	collectionStream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collectionStream.Close()
+
+	received := time.Unix(1500000000, 0)
+	err = srv.Inject(collection.ID, device.ID, nbiottest.Message{
+		Payload:    []byte("up"),
+		Received:   received,
+		LocalPort:  1234,
+		RemotePort: 4321,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stream := range []*nbiot.OutputStream{deviceStream, collectionStream} {
+		m, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(m.Payload) != "up" || m.Device.ID != device.ID || m.Transport != "udp" ||
+			m.Received != received.UnixNano()/int64(time.Millisecond) || m.UDPMetaData.LocalPort != 1234 || m.Extra != nil {
+			t.Fatal("unexpected message:", m)
+		}
+	}
+
+	if data, err := client.DeviceData(collection.ID, device.ID, time.Time{}, time.Time{}, 0); err != nil || len(data) != 1 {
+		t.Fatal(err, data)
+	}
+	if data, err := client.CollectionData(collection.ID, time.Time{}, time.Time{}, 0); err != nil || len(data) != 1 {
+		t.Fatal(err, data)
+	}
+
+	if err := client.Send(collection.ID, device.ID, msg); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := client.Broadcast(collection.ID, msg); err != nil || res.Sent != 1 {
+		t.Fatal(err, res)
+	}
+	sent := srv.Sent()
+	if len(sent) != 2 || sent[0].DeviceID != device.ID || sent[0].Port != 1234 || string(sent[0].Payload) != "down" ||
+		sent[0].Broadcast || !sent[1].Broadcast {
+		t.Fatal("unexpected sent messages:", sent)
+	}
+}
@@ -0,0 +1,142 @@
+package nbiottest
+
+import (
+	"fmt"
+	"time"
+)
+
+// These are the transports of upstream messages.
+const (
+	TransportUDP  = "udp"
+	TransportCoAP = "coap"
+)
+
+// Message is an upstream message from a device, to be injected with Inject.
+type Message struct {
+	Payload   []byte
+	Transport string    // TransportUDP if empty
+	Received  time.Time // The current time if zero
+
+	// UDP metadata
+	LocalPort  int // The port the message was sent to
+	RemotePort int // The port the message was sent from
+
+	// CoAP metadata
+	Method string // E.g. "POST"
+	Path   string // E.g. "/sensors/1"
+}
+
+// Downstream is a message sent to a device with Send or Broadcast.
+type Downstream struct {
+	CollectionID string
+	DeviceID     string
+	Port         int
+	Payload      []byte
+	Path         string // The CoAP path, if any
+	Transport    string // The transport requested by the sender, if any
+	Broadcast    bool   // Whether the message was sent with Broadcast
+}
+
+// Inject makes it appear as if the device sent a message. The message is
+// sent to the output streams of the device and its collection and stored so
+// that it's returned by data queries.
+//
+// As with the real service, messages can only be sent to devices that have
+// sent something, so Send and Broadcast fail for a device until a message has
+// been injected for it.
+func (s *Server) Inject(collectionID, deviceID string, msg Message) error {
+	s.mu.Lock()
+	d, ok := s.devices[deviceID]
+	if !ok || d.CollectionID != collectionID {
+		s.mu.Unlock()
+		return fmt.Errorf("nbiottest: no device %s in collection %s", deviceID, collectionID)
+	}
+
+	m := &message{
+		Device:    *d,
+		Payload:   msg.Payload,
+		Received:  msg.Received.UnixNano() / int64(time.Millisecond),
+		Transport: msg.Transport,
+	}
+	m.Device.Tags = copyTags(d.Tags)
+	if msg.Received.IsZero() {
+		m.Received = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	if m.Transport == "" {
+		m.Transport = TransportUDP
+	}
+	m.UDPMetaData.LocalPort = msg.LocalPort
+	m.UDPMetaData.RemotePort = msg.RemotePort
+	m.CoAPMetaData.Method = msg.Method
+	m.CoAPMetaData.Path = msg.Path
+
+	// Keep the data sorted by the time received so that data queries
+	// return the newest messages first.
+	i := len(s.data)
+	for i > 0 && s.data[i-1].Received > m.Received {
+		i--
+	}
+	s.data = append(s.data, nil)
+	copy(s.data[i+1:], s.data[i:])
+	s.data[i] = m
+	s.reachable[d.ID] = true
+
+	var streams []*stream
+	for st := range s.streams {
+		if st.collectionID == collectionID && (st.deviceID == "" || st.deviceID == deviceID) {
+			streams = append(streams, st)
+		}
+	}
+	s.mu.Unlock()
+
+	frame := struct {
+		Type string `json:"type"`
+		*message
+	}{"data", m}
+	for _, st := range streams {
+		// Errors are ignored; the stream is removed when its client goes
+		// away.
+		st.write(frame)
+	}
+	return nil
+}
+
+// Sent returns all messages that have been sent to devices, in the order they
+// were sent.
+func (s *Server) Sent() []Downstream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Downstream(nil), s.sent...)
+}
+
+// DropStreams closes the connections of all output streams without a close
+// frame, as if the network failed. Clients may connect again right away.
+func (s *Server) DropStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for st := range s.streams {
+		st.ws.UnderlyingConn().Close()
+	}
+}
+
+// SendFrame sends a frame to all output streams, e.g. a keepalive such as
+// {"type": "keepalive"} or a notice. The frame is encoded as JSON.
+func (s *Server) SendFrame(frame interface{}) {
+	s.mu.Lock()
+	streams := make([]*stream, 0, len(s.streams))
+	for st := range s.streams {
+		streams = append(streams, st)
+	}
+	s.mu.Unlock()
+	for _, st := range streams {
+		st.write(frame)
+	}
+}
+
+// StallStreams makes all output streams, including those opened later, stop
+// answering pings, as if the connections were half-open.
+func (s *Server) StallStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stalled = true
+}
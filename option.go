@@ -0,0 +1,55 @@
+package nbiot
+
+import (
+	"net/http"
+	"time"
+)
+
+// userAgent is the User-Agent header sent with every request.
+const userAgent = "nbiot-go"
+
+// Option configures a Client. Options are passed to New or NewWithOptions.
+type Option func(*Client)
+
+// WithHTTPClient makes the client use hc for all REST requests. The HTTP
+// client is used as is, so its timeout and transport settings apply.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.client = hc
+	}
+}
+
+// WithTransport makes the client use rt as the transport for REST requests.
+// The HTTP client set with WithHTTPClient is copied rather than modified.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		hc := *c.client
+		hc.Transport = rt
+		c.client = &hc
+	}
+}
+
+// WithTimeout sets a timeout for each API call. The timeout covers the whole
+// call, including reading the response, and the websocket handshake for
+// output streams. A zero timeout means no timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithUserAgent appends suffix to the User-Agent header sent by the client.
+func WithUserAgent(suffix string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent + " " + suffix
+	}
+}
+
+// WithoutPing skips the check that the API is reachable when creating the
+// client. This makes it possible to create clients without network access,
+// e.g. in tests.
+func WithoutPing() Option {
+	return func(c *Client) {
+		c.noPing = true
+	}
+}
@@ -0,0 +1,89 @@
+package nbiot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithoutPing(t *testing.T) {
+	client, err := NewWithOptions("http://127.0.0.1:0", "token", WithoutPing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Address() != "http://127.0.0.1:0" {
+		t.Fatal("unexpected address:", client.Address())
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	var ua string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	if _, err := NewWithOptions(srv.URL, "token", WithUserAgent("test/1.0")); err != nil {
+		t.Fatal(err)
+	}
+	if ua != "nbiot-go test/1.0" {
+		t.Fatalf("unexpected user agent %q", ua)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewWithOptions(srv.URL, "token", WithoutPing(), WithTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Collections(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithTransport(t *testing.T) {
+	var paths []string
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Path)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})
+
+	hc := &http.Client{}
+	client, err := NewWithOptions("http://example.com", "token", WithHTTPClient(hc), WithTransport(rt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hc.Transport != nil {
+		t.Fatal("WithTransport modified the HTTP client")
+	}
+	if err := client.DeleteCollection("1"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(paths, ",") != "/,/collections/1" {
+		t.Fatal("unexpected requests:", paths)
+	}
+}
@@ -1,6 +1,9 @@
 package nbiot
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // Output represents a data output for a collection.
 // WebHookOutput, MQTTOutput, IFTTTOutput, and UDPOutput implement this interface.
@@ -63,8 +66,13 @@ type UDPOutput struct {
 
 // Output retrieves an output
 func (c *Client) Output(collectionID, outputID string) (Output, error) {
+	return c.OutputContext(context.Background(), collectionID, outputID)
+}
+
+// OutputContext retrieves an output using the provided context.
+func (c *Client) OutputContext(ctx context.Context, collectionID, outputID string) (Output, error) {
 	var output output
-	err := c.get(fmt.Sprintf("/collections/%s/outputs/%s", collectionID, outputID), &output)
+	err := c.get(ctx, fmt.Sprintf("/collections/%s/outputs/%s", collectionID, outputID), &output)
 	if err != nil {
 		return nil, err
 	}
@@ -73,10 +81,16 @@ func (c *Client) Output(collectionID, outputID string) (Output, error) {
 
 // Outputs retrieves a list of outputs on a collection
 func (c *Client) Outputs(collectionID string) ([]Output, error) {
+	return c.OutputsContext(context.Background(), collectionID)
+}
+
+// OutputsContext retrieves a list of outputs on a collection using the
+// provided context.
+func (c *Client) OutputsContext(ctx context.Context, collectionID string) ([]Output, error) {
 	var outputs struct {
 		Outputs []output `json:"outputs"`
 	}
-	err := c.get(fmt.Sprintf("/collections/%s/outputs", collectionID), &outputs)
+	err := c.get(ctx, fmt.Sprintf("/collections/%s/outputs", collectionID), &outputs)
 	if err != nil {
 		return nil, err
 	}
@@ -93,8 +107,13 @@ func (c *Client) Outputs(collectionID string) ([]Output, error) {
 
 // CreateOutput creates an output
 func (c *Client) CreateOutput(collectionID string, output Output) (Output, error) {
+	return c.CreateOutputContext(context.Background(), collectionID, output)
+}
+
+// CreateOutputContext creates an output using the provided context.
+func (c *Client) CreateOutputContext(ctx context.Context, collectionID string, output Output) (Output, error) {
 	o := output.toOutput()
-	err := c.create(fmt.Sprintf("/collections/%s/outputs", collectionID), &o)
+	err := c.create(ctx, fmt.Sprintf("/collections/%s/outputs", collectionID), &o)
 	if err != nil {
 		return nil, err
 	}
@@ -104,8 +123,14 @@ func (c *Client) CreateOutput(collectionID string, output Output) (Output, error
 // UpdateOutput updates an output. The type field can't be modified
 // No tags are deleted, only added or updated.
 func (c *Client) UpdateOutput(collectionID string, output Output) (Output, error) {
+	return c.UpdateOutputContext(context.Background(), collectionID, output)
+}
+
+// UpdateOutputContext updates an output using the provided context.
+// No tags are deleted, only added or updated.
+func (c *Client) UpdateOutputContext(ctx context.Context, collectionID string, output Output) (Output, error) {
 	o := output.toOutput()
-	err := c.update(fmt.Sprintf("/collections/%s/outputs/%s", collectionID, *o.ID), &o)
+	err := c.update(ctx, fmt.Sprintf("/collections/%s/outputs/%s", collectionID, *o.ID), &o)
 	if err != nil {
 		return nil, err
 	}
@@ -121,10 +146,15 @@ type OutputLogEntry struct {
 
 // OutputLogs returns the logs for an output.
 func (c *Client) OutputLogs(collectionID, outputID string) ([]OutputLogEntry, error) {
+	return c.OutputLogsContext(context.Background(), collectionID, outputID)
+}
+
+// OutputLogsContext returns the logs for an output using the provided context.
+func (c *Client) OutputLogsContext(ctx context.Context, collectionID, outputID string) ([]OutputLogEntry, error) {
 	var log struct {
 		Logs []OutputLogEntry `json:"logs"`
 	}
-	err := c.get(fmt.Sprintf("/collections/%s/outputs/%s/logs", collectionID, outputID), &log)
+	err := c.get(ctx, fmt.Sprintf("/collections/%s/outputs/%s/logs", collectionID, outputID), &log)
 	return log.Logs, err
 }
 
@@ -137,19 +167,36 @@ type OutputStatus struct {
 }
 
 // OutputStatus returns the status for an output.
-func (c *Client) OutputStatus(collectionID, outputID string) (stat OutputStatus, err error) {
-	err = c.get(fmt.Sprintf("/collections/%s/outputs/%s/status", collectionID, outputID), &stat)
+func (c *Client) OutputStatus(collectionID, outputID string) (OutputStatus, error) {
+	return c.OutputStatusContext(context.Background(), collectionID, outputID)
+}
+
+// OutputStatusContext returns the status for an output using the provided
+// context.
+func (c *Client) OutputStatusContext(ctx context.Context, collectionID, outputID string) (stat OutputStatus, err error) {
+	err = c.get(ctx, fmt.Sprintf("/collections/%s/outputs/%s/status", collectionID, outputID), &stat)
 	return stat, err
 }
 
 // DeleteOutputTag deletes a tag from an output.
 func (c *Client) DeleteOutputTag(collectionID, outputID, name string) error {
-	return c.delete(fmt.Sprintf("/collections/%s/outputs/%s/tags/%s", collectionID, outputID, name))
+	return c.DeleteOutputTagContext(context.Background(), collectionID, outputID, name)
+}
+
+// DeleteOutputTagContext deletes a tag from an output using the provided
+// context.
+func (c *Client) DeleteOutputTagContext(ctx context.Context, collectionID, outputID, name string) error {
+	return c.delete(ctx, fmt.Sprintf("/collections/%s/outputs/%s/tags/%s", collectionID, outputID, name))
 }
 
 // DeleteOutput removes an output
 func (c *Client) DeleteOutput(collectionID, outputID string) error {
-	return c.delete(fmt.Sprintf("/collections/%s/outputs/%s", collectionID, outputID))
+	return c.DeleteOutputContext(context.Background(), collectionID, outputID)
+}
+
+// DeleteOutputContext removes an output using the provided context.
+func (c *Client) DeleteOutputContext(ctx context.Context, collectionID, outputID string) error {
+	return c.delete(ctx, fmt.Sprintf("/collections/%s/outputs/%s", collectionID, outputID))
 }
 
 // GetID returns the output ID.
@@ -1,89 +1,328 @@
 package nbiot
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
-// OutputStream provides a stream of OutputDataMessages.
+// ErrStreamClosed is returned when receiving from a stream after Close.
+var ErrStreamClosed = errors.New("nbiot: stream closed")
+
+// OutputStream provides a stream of OutputDataMessages. Messages are read by
+// a goroutine and can be received with Recv, RecvContext or Messages. All
+// methods are safe for concurrent use, and Close can be called at any time to
+// stop a receiving goroutine.
 type OutputStream struct {
-	ws *websocket.Conn
+	ws      *websocket.Conn
+	client  *Client
+	path    string
+	session StreamSession
+
+	msgs      chan OutputDataMessage
+	closing   chan struct{} // Closed by Close
+	done      chan struct{} // Closed when the reader has stopped
+	err       error         // Why the reader stopped, set before done is closed
+	closeOnce sync.Once
+}
+
+// StreamObserver observes output streams, e.g. for tracing. Set it with
+// WithStreamObserver.
+type StreamObserver interface {
+	// StreamOpened is called when an output stream has been established. The
+	// returned session, if not nil, is notified of the stream's messages
+	// and of its end.
+	StreamOpened(ctx context.Context, req *Request) StreamSession
+}
+
+// StreamSession observes a single output stream. Its methods are called by the
+// goroutine reading the stream, so they must not call the stream's Close.
+type StreamSession interface {
+	// Message is called for each message received on the stream.
+	Message(msg OutputDataMessage)
+
+	// Closed is called once when the stream ends. err is nil if the stream
+	// was closed with Close.
+	Closed(err error)
+}
+
+// WithStreamObserver makes the client notify o of all output streams.
+func WithStreamObserver(o StreamObserver) Option {
+	return func(c *Client) {
+		c.streamObservers = append(c.streamObservers, o)
+	}
 }
 
-// OutputDataMessage represents a message sent by a device.
-type OutputDataMessage struct {
-	Device       Device `json:"device"`
-	Payload      []byte `json:"payload"`
-	Received     int64  `json:"received,string"`
-	Transport    string `json:"transport"`
-	CoAPMetaData struct {
-		Method string `json:"method"`
-		Path   string `json:"path"`
-	} `json:"coapMetaData"`
-	UDPMetaData struct {
-		LocalPort  int `json:"localPort"`
-		RemotePort int `json:"remotePort"`
-	} `json:"udpMetaData"`
+// streamSessions notifies several sessions.
+type streamSessions []StreamSession
+
+func (s streamSessions) Message(msg OutputDataMessage) {
+	for _, session := range s {
+		session.Message(msg)
+	}
+}
+
+func (s streamSessions) Closed(err error) {
+	for _, session := range s {
+		session.Closed(err)
+	}
 }
 
 // CollectionOutputStream streams messages from all devices in a collection.
 func (c *Client) CollectionOutputStream(collectionID string) (*OutputStream, error) {
-	return c.outputStream(fmt.Sprintf("/collections/%s", collectionID))
+	return c.CollectionOutputStreamContext(context.Background(), collectionID)
+}
+
+// CollectionOutputStreamContext streams messages from all devices in a
+// collection. The context is used for the websocket handshake only; once the
+// stream is established it is closed with Close.
+func (c *Client) CollectionOutputStreamContext(ctx context.Context, collectionID string) (*OutputStream, error) {
+	return c.outputStream(ctx, fmt.Sprintf("/collections/%s", collectionID))
 }
 
 // DeviceOutputStream streams messages from one device.
 func (c *Client) DeviceOutputStream(collectionID, deviceID string) (*OutputStream, error) {
-	return c.outputStream(fmt.Sprintf("/collections/%s/devices/%s", collectionID, deviceID))
+	return c.DeviceOutputStreamContext(context.Background(), collectionID, deviceID)
 }
 
-func (c *Client) outputStream(path string) (*OutputStream, error) {
-	url, err := url.Parse(c.addr)
-	if err != nil {
+// DeviceOutputStreamContext streams messages from one device. The context is
+// used for the websocket handshake only; once the stream is established it is
+// closed with Close.
+func (c *Client) DeviceOutputStreamContext(ctx context.Context, collectionID, deviceID string) (*OutputStream, error) {
+	return c.outputStream(ctx, fmt.Sprintf("/collections/%s/devices/%s", collectionID, deviceID))
+}
+
+func (c *Client) outputStream(ctx context.Context, path string) (*OutputStream, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var ws *websocket.Conn
+	dial := func(ctx context.Context, req *Request) (*Response, error) {
+		url, err := url.Parse(c.addr)
+		if err != nil {
+			return nil, err
+		}
+
+		scheme := "wss"
+		if url.Scheme == "http" {
+			scheme = "ws"
+		}
+
+		urlStr := fmt.Sprintf("%s://%s%s", scheme, url.Host, req.Path)
+
+		header := http.Header{}
+		for k, v := range req.Header {
+			header[k] = v
+		}
+		header.Set("X-API-Token", c.token)
+
+		conn, resp, err := c.streamDialer().DialContext(ctx, urlStr, header)
+		if err != nil {
+			serr := &StreamError{URL: urlStr, Err: err}
+			if resp == nil {
+				// The handshake never got a response, e.g. because the context
+				// was cancelled.
+				return nil, serr
+			}
+			serr.StatusCode = resp.StatusCode
+			if body, err := io.ReadAll(resp.Body); err == nil {
+				serr.Body = string(body)
+			}
+			resp.Body.Close()
+			return &Response{StatusCode: resp.StatusCode, Header: resp.Header}, serr
+		}
+		ws = conn
+		return &Response{StatusCode: resp.StatusCode, Header: resp.Header}, nil
+	}
+
+	req := c.newRequest(http.MethodGet, path+"/from")
+	req.Stream = true
+	if _, err := c.chain(dial)(ctx, req); err != nil {
+		if ws != nil {
+			ws.Close()
+		}
 		return nil, err
 	}
 
-	scheme := "wss"
-	if url.Scheme == "http" {
-		scheme = "ws"
+	c.log(ctx, slog.LevelInfo, "nbiot: output stream connected", slog.String("path", req.Path))
+
+	var sessions streamSessions
+	for _, o := range c.streamObservers {
+		if session := o.StreamOpened(ctx, req); session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+	s := &OutputStream{
+		ws:      ws,
+		client:  c,
+		path:    req.Path,
+		session: sessions,
+		msgs:    make(chan OutputDataMessage),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.read()
+	return s, nil
+}
+
+// Recv blocks until a new message is received. It returns io.EOF if the stream
+// is closed by the server and ErrStreamClosed after Close.
+func (s *OutputStream) Recv() (OutputDataMessage, error) {
+	return s.RecvContext(context.Background())
+}
+
+// RecvContext blocks until a new message is received or the context is done.
+// The stream can still be used after the context is done. It returns io.EOF
+// if the stream is closed by the server and ErrStreamClosed after Close.
+func (s *OutputStream) RecvContext(ctx context.Context) (OutputDataMessage, error) {
+	select {
+	case msg, ok := <-s.msgs:
+		if !ok {
+			return OutputDataMessage{}, s.recvErr()
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return OutputDataMessage{}, ctx.Err()
 	}
+}
 
-	urlStr := fmt.Sprintf("%s://%s%s/from", scheme, url.Host, path)
+// Messages returns a channel of the stream's messages. It is closed when the
+// stream ends, after which Err returns the reason. Messages and Recv can't be
+// used to receive the same message.
+func (s *OutputStream) Messages() <-chan OutputDataMessage {
+	return s.msgs
+}
 
-	header := http.Header{}
-	header.Add("X-API-Token", c.token)
+// Done returns a channel that is closed when the stream has ended.
+func (s *OutputStream) Done() <-chan struct{} {
+	return s.done
+}
 
-	dialer := websocket.Dialer{}
-	ws, resp, err := dialer.Dial(urlStr, header)
-	if err != nil {
-		return nil, fmt.Errorf("handshake failed with status %d", resp.StatusCode)
+// Err returns the error that ended the stream, e.g. io.EOF if it was closed by
+// the server. It returns nil if the stream hasn't ended or was ended by Close.
+func (s *OutputStream) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
 	}
+}
 
-	return &OutputStream{ws}, nil
+// recvErr returns the error for receiving from a stream that has ended.
+func (s *OutputStream) recvErr() error {
+	<-s.done
+	if s.err == nil {
+		return ErrStreamClosed
+	}
+	return s.err
 }
 
-// Recv blocks until a new message is received.
-// It returns io.EOF if the stream is closed by the server.
-func (s *OutputStream) Recv() (OutputDataMessage, error) {
+// Close closes the output stream. It can be called several times and
+// concurrently with the other methods. It returns when the stream has ended,
+// so it must not be called from a frame handler or a StreamSession, which are
+// called by the goroutine reading the stream; use go stream.Close() there.
+func (s *OutputStream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		s.ws.Close()
+	})
+	<-s.done
+}
+
+// read reads messages until the stream ends, and closes the connection then.
+func (s *OutputStream) read() {
+	defer close(s.done)
+	defer close(s.msgs)
+	defer s.ws.Close()
+	s.keepalive()
+	for {
+		msg, err := s.readMessage()
+		if err != nil {
+			select {
+			case <-s.closing:
+				err = nil
+			default:
+			}
+			s.err = err
+			s.end(err)
+			return
+		}
+		select {
+		case s.msgs <- msg:
+		case <-s.closing:
+			s.end(nil)
+			return
+		}
+	}
+}
+
+// readMessage reads frames until a data frame is received. Other frames are
+// passed to the client's frame handler.
+func (s *OutputStream) readMessage() (OutputDataMessage, error) {
 	for {
-		var msg struct {
-			Type string `json:"type"`
-			OutputDataMessage
+		_, data, err := s.ws.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			return OutputDataMessage{}, io.EOF
+		}
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return OutputDataMessage{}, fmt.Errorf("%w: nothing received for %v", ErrStreamTimeout, s.client.pingInterval+s.client.pongTimeout)
 		}
-		err := s.ws.ReadJSON(&msg)
 		if err != nil {
 			return OutputDataMessage{}, err
 		}
+		s.extendDeadline()
+
+		// The frame type is decoded along with the message, as an unknown
+		// field, since embedding the message in a struct with the type would
+		// make the message's UnmarshalJSON decode the whole frame.
+		var msg OutputDataMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return OutputDataMessage{}, err
+		}
+		var typ string
+		json.Unmarshal(msg.Extra["type"], &typ)
+		delete(msg.Extra, "type")
+		if len(msg.Extra) == 0 {
+			msg.Extra = nil
+		}
 
-		if msg.Type == "data" {
-			return msg.OutputDataMessage, nil
+		switch {
+		case typ == "data":
+			s.client.decode(context.Background(), &msg)
+			s.session.Message(msg)
+			return msg, nil
+		case strings.EqualFold(typ, "keepalive"):
+			s.frame(KeepaliveFrame{})
+		default:
+			s.client.log(context.Background(), slog.LevelDebug, "nbiot: unknown output stream frame",
+				slog.String("path", s.path), slog.String("type", typ))
+			s.frame(RawFrame{Type: typ, Data: data})
 		}
 	}
 }
 
-// Close closes the output stream.
-func (s *OutputStream) Close() {
-	s.ws.Close()
+// end logs the end of the stream and notifies its observers.
+func (s *OutputStream) end(err error) {
+	if err != nil {
+		s.client.log(context.Background(), slog.LevelInfo, "nbiot: output stream disconnected",
+			slog.String("path", s.path), slog.Any("error", err))
+	} else {
+		s.client.log(context.Background(), slog.LevelInfo, "nbiot: output stream closed", slog.String("path", s.path))
+	}
+	s.session.Closed(err)
 }
@@ -1,8 +1,14 @@
 package nbiot
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
 )
 
 func TestCollectionOutputStream(t *testing.T) {
@@ -22,14 +28,172 @@ func TestCollectionOutputStream(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for {
 			_, err := stream.Recv()
+			if errors.Is(err, ErrStreamClosed) {
+				return
+			}
 			if err != nil {
-				t.Fatalf("%#v", err)
+				t.Errorf("%#v", err)
+				return
 			}
 		}
 	}()
 
 	time.Sleep(time.Second)
+	stream.Close()
+	<-done
+}
+
+func TestOutputStreamContextCanceled(t *testing.T) {
+	client, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.CollectionOutputStreamContext(ctx, "0"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestOutputStreamReceive(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// The stream can be used after RecvContext times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := stream.RecvContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+	for _, payload := range []string{"1", "2"} {
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(payload)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg, err := stream.RecvContext(context.Background())
+	if err != nil || string(msg.Payload) != "1" {
+		t.Fatalf("got %q, %v", msg.Payload, err)
+	}
+	select {
+	case msg := <-stream.Messages():
+		if string(msg.Payload) != "2" {
+			t.Fatalf("got %q", msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+	}
+
+	// Dropping the connection ends the stream with an error.
+	srv.DropStreams()
+	for range stream.Messages() {
+	}
+	<-stream.Done()
+	if stream.Err() == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := stream.Recv(); err != stream.Err() {
+		t.Fatalf("got %v, want %v", err, stream.Err())
+	}
+}
+
+func TestOutputStreamClose(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := stream.Recv(); !errors.Is(err, ErrStreamClosed) {
+				t.Error("expected ErrStreamClosed, got", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream.Close()
+		}()
+	}
+	wg.Wait()
+
+	if err := stream.Err(); err != nil {
+		t.Fatal("expected no error after Close, got", err)
+	}
+	if _, ok := <-stream.Messages(); ok {
+		t.Fatal("expected Messages to be closed")
+	}
+}
+
+func TestOutputStreamLost(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	var open atomic.Int32
+	client, err := NewWithOptions(srv.URL, srv.Token, WithStreamDialer(countingDialer(&open)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection is closed when the stream ends, without calling Close.
+	srv.DropStreams()
+	for range stream.Messages() {
+	}
+	if stream.Err() == nil {
+		t.Fatal("expected an error")
+	}
+	if n := open.Load(); n != 0 {
+		t.Fatalf("%d connections open after the stream ended", n)
+	}
 }
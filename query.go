@@ -0,0 +1,111 @@
+package nbiot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DataQuery is a query for stored data. It queries a device if DeviceID is
+// set and the whole collection otherwise. It can be serialized as JSON.
+type DataQuery struct {
+	CollectionID string    `json:"collectionId"`
+	DeviceID     string    `json:"deviceId,omitempty"`
+	Since        time.Time `json:"since"`           // The earliest time to include, if not zero
+	Until        time.Time `json:"until"`           // The latest time to include, if not zero
+	Limit        int       `json:"limit,omitempty"` // The maximum number of messages; if zero, the API's default for NewestFirst and 100 for OldestFirst
+	Order        Order     `json:"order"`
+}
+
+// Validate checks that the query is well-formed.
+func (q DataQuery) Validate() error {
+	if q.CollectionID == "" {
+		return errors.New("nbiot: data query without a collection")
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && q.Since.After(q.Until) {
+		return fmt.Errorf("nbiot: data query since %v is after until %v", q.Since, q.Until)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("nbiot: data query with negative limit %d", q.Limit)
+	}
+	if q.Order != NewestFirst && q.Order != OldestFirst {
+		return fmt.Errorf("nbiot: data query with unknown order %d", q.Order)
+	}
+	return nil
+}
+
+// path returns the path of the query's resource.
+func (q DataQuery) path() string {
+	if q.DeviceID != "" {
+		return fmt.Sprintf("/collections/%s/devices/%s/data", q.CollectionID, q.DeviceID)
+	}
+	return fmt.Sprintf("/collections/%s/data", q.CollectionID)
+}
+
+// QueryData returns the stored data matching the query.
+func (c *Client) QueryData(q DataQuery) ([]OutputDataMessage, error) {
+	return c.QueryDataContext(context.Background(), q)
+}
+
+// QueryDataContext returns the stored data matching the query using the
+// provided context.
+func (c *Client) QueryDataContext(ctx context.Context, q DataQuery) ([]OutputDataMessage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if q.Order == NewestFirst && q.Limit <= maxDataLimit {
+		// A zero limit is left to the API.
+		return c.data(ctx, q.path(), millis(q.Since), millis(q.Until), q.Limit)
+	}
+
+	// The API returns the newest messages first, and no more than
+	// maxDataLimit at once, so the others have to be found by paging.
+	limit := q.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	it := c.dataIterator(ctx, q.path(), DataIteratorOptions{
+		Since:    q.Since,
+		Until:    q.Until,
+		PageSize: limit,
+		Order:    q.Order,
+	})
+	var messages []OutputDataMessage
+	for len(messages) < limit && it.Next() {
+		messages = append(messages, it.Message())
+	}
+	return messages, it.Err()
+}
+
+// String returns the name of the order.
+func (o Order) String() string {
+	switch o {
+	case NewestFirst:
+		return "newestFirst"
+	case OldestFirst:
+		return "oldestFirst"
+	}
+	return fmt.Sprintf("Order(%d)", int(o))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (o Order) MarshalText() ([]byte, error) {
+	if o != NewestFirst && o != OldestFirst {
+		return nil, fmt.Errorf("nbiot: unknown order %d", o)
+	}
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (o *Order) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "newestFirst", "":
+		*o = NewestFirst
+	case "oldestFirst":
+		*o = OldestFirst
+	default:
+		return fmt.Errorf("nbiot: unknown order %q", text)
+	}
+	return nil
+}
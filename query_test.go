@@ -0,0 +1,128 @@
+package nbiot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func TestDataQueryValidate(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		q  DataQuery
+		ok bool
+	}{
+		{DataQuery{CollectionID: "c"}, true},
+		{DataQuery{CollectionID: "c", DeviceID: "d", Since: now, Until: now, Limit: 10, Order: OldestFirst}, true},
+		{DataQuery{DeviceID: "d"}, false},
+		{DataQuery{CollectionID: "c", Since: now, Until: now.Add(-time.Second)}, false},
+		{DataQuery{CollectionID: "c", Limit: -1}, false},
+		{DataQuery{CollectionID: "c", Order: 2}, false},
+	} {
+		if err := test.q.Validate(); (err == nil) != test.ok {
+			t.Errorf("%+v: unexpected error %v", test.q, err)
+		}
+	}
+}
+
+func TestDataQueryJSON(t *testing.T) {
+	q := DataQuery{CollectionID: "c", DeviceID: "d", Since: time.Unix(1500000000, 0).UTC(), Limit: 10, Order: OldestFirst}
+	b, err := json.Marshal(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got DataQuery
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != q {
+		t.Fatalf("got %+v, want %+v", got, q)
+	}
+	if err := json.Unmarshal([]byte(`{"order":"sideways"}`), &got); err == nil {
+		t.Fatal("expected error for unknown order")
+	}
+}
+
+func TestQueryData(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	var paths []string
+	record := func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			paths = append(paths, req.Path)
+			return next(ctx, req)
+		}
+	}
+	client, err := NewWithOptions(srv.URL, srv.Token, WithInterceptors(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1500000000, 0)
+	for i := 0; i < 10; i++ {
+		received := start.Add(time.Duration(i) * time.Second)
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(fmt.Sprint(i)), Received: received}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		q    DataQuery
+		want string
+	}{
+		{DataQuery{CollectionID: collection.ID, Limit: 3}, "[9 8 7]"},
+		{DataQuery{CollectionID: collection.ID, DeviceID: device.ID, Limit: 3, Order: OldestFirst}, "[0 1 2]"},
+		{DataQuery{CollectionID: collection.ID, Since: start.Add(4 * time.Second), Until: start.Add(6 * time.Second), Order: OldestFirst}, "[4 5 6]"},
+	} {
+		data, err := client.QueryData(test.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payloads []string
+		for _, msg := range data {
+			payloads = append(payloads, string(msg.Payload))
+		}
+		if got := fmt.Sprint(payloads); got != test.want {
+			t.Errorf("%+v: got %s, want %s", test.q, got, test.want)
+		}
+	}
+
+	// A zero limit is left to the API when newest first, and means 100
+	// when oldest first. The fake API's default is 100 as well.
+	for i := 10; i < 120; i++ {
+		received := start.Add(time.Duration(i) * time.Second)
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(fmt.Sprint(i)), Received: received}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, order := range []Order{NewestFirst, OldestFirst} {
+		paths = nil
+		data, err := client.QueryData(DataQuery{CollectionID: collection.ID, Order: order})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 100 {
+			t.Errorf("%v: got %d messages, want 100", order, len(data))
+		}
+		if order == NewestFirst && (len(paths) != 1 || !strings.HasSuffix(paths[0], "&limit=0")) {
+			t.Errorf("%v: unexpected requests %v", order, paths)
+		}
+	}
+
+	if _, err := client.DeviceData(collection.ID, device.ID, start.Add(time.Second), start, 0); err == nil {
+		t.Fatal("expected error for since after until")
+	}
+}
@@ -0,0 +1,328 @@
+package nbiot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// StreamState is the connection state of a ReconnectingStream.
+type StreamState int
+
+// These are the states of a ReconnectingStream.
+const (
+	StreamConnected    StreamState = iota // Connected again after an outage
+	StreamDisconnected                    // The connection was lost
+	StreamReconnecting                    // Attempting to connect again
+)
+
+func (s StreamState) String() string {
+	switch s {
+	case StreamConnected:
+		return "connected"
+	case StreamDisconnected:
+		return "disconnected"
+	case StreamReconnecting:
+		return "reconnecting"
+	}
+	return fmt.Sprintf("StreamState(%d)", int(s))
+}
+
+// StreamEvent is a change of the connection state of a ReconnectingStream.
+type StreamEvent struct {
+	State StreamState
+
+	// Err is the reason the connection was lost for StreamDisconnected, the
+	// error of the previous attempt for StreamReconnecting, and the error
+	// back-filling the outage, if any, for StreamConnected.
+	Err error
+
+	Attempt    int           // The reconnect attempt, from 1
+	Outage     time.Duration // The time since the connection was lost
+	Backfilled int           // The number of messages back-filled for StreamConnected
+}
+
+// ReconnectOptions are the options of a ReconnectingStream.
+type ReconnectOptions struct {
+	MinBackoff  time.Duration // The base delay between attempts; 1 second if zero
+	MaxBackoff  time.Duration // The maximum delay between attempts; 1 minute if zero
+	MaxAttempts int           // The number of attempts before giving up; unlimited if zero
+
+	// DedupWindow is how far back messages are remembered to drop those
+	// received both live and when back-filling. The default is 5 minutes.
+	DedupWindow time.Duration
+
+	// OnEvent, if set, is called from Recv when the connection state
+	// changes.
+	OnEvent func(StreamEvent)
+}
+
+// ReconnectingStream is an output stream that connects again when its
+// connection is lost. After connecting again it back-fills the messages stored
+// during the outage through data queries, so that no messages are lost, and
+// drops messages that are received twice.
+type ReconnectingStream struct {
+	client       *Client
+	ctx          context.Context
+	cancel       context.CancelFunc
+	path         string
+	collectionID string
+	query        DataQuery
+	opts         ReconnectOptions
+
+	mu     sync.Mutex // Guards stream and closed
+	stream *OutputStream
+	closed bool
+
+	pending []OutputDataMessage // Back-filled messages not yet returned
+	last    int64               // The newest Received
+	pruned  int64               // The newest Received when seen was last pruned
+	seen    map[messageKey]bool // Messages received within the dedup window
+}
+
+// ReconnectingCollectionStream streams messages from all devices in a
+// collection, connecting again as needed.
+func (c *Client) ReconnectingCollectionStream(collectionID string, opts ReconnectOptions) (*ReconnectingStream, error) {
+	return c.ReconnectingCollectionStreamContext(context.Background(), collectionID, opts)
+}
+
+// ReconnectingCollectionStreamContext streams messages from all devices in a
+// collection, connecting again as needed. The first connection must succeed.
+// The stream ends when the context is done or the stream is closed.
+func (c *Client) ReconnectingCollectionStreamContext(ctx context.Context, collectionID string, opts ReconnectOptions) (*ReconnectingStream, error) {
+	return c.reconnectingStream(ctx, DataQuery{CollectionID: collectionID}, opts)
+}
+
+// ReconnectingDeviceStream streams messages from one device, connecting again
+// as needed.
+func (c *Client) ReconnectingDeviceStream(collectionID, deviceID string, opts ReconnectOptions) (*ReconnectingStream, error) {
+	return c.ReconnectingDeviceStreamContext(context.Background(), collectionID, deviceID, opts)
+}
+
+// ReconnectingDeviceStreamContext streams messages from one device,
+// connecting again as needed. The first connection must succeed. The stream
+// ends when the context is done or the stream is closed.
+func (c *Client) ReconnectingDeviceStreamContext(ctx context.Context, collectionID, deviceID string, opts ReconnectOptions) (*ReconnectingStream, error) {
+	return c.reconnectingStream(ctx, DataQuery{CollectionID: collectionID, DeviceID: deviceID}, opts)
+}
+
+func (c *Client) reconnectingStream(ctx context.Context, q DataQuery, opts ReconnectOptions) (*ReconnectingStream, error) {
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+	if opts.DedupWindow <= 0 {
+		opts.DedupWindow = 5 * time.Minute
+	}
+
+	path := fmt.Sprintf("/collections/%s", q.CollectionID)
+	if q.DeviceID != "" {
+		path = fmt.Sprintf("/collections/%s/devices/%s", q.CollectionID, q.DeviceID)
+	}
+	start := millis(time.Now())
+	stream, err := c.outputStream(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &ReconnectingStream{
+		client:       c,
+		ctx:          ctx,
+		cancel:       cancel,
+		path:         path,
+		collectionID: q.CollectionID,
+		query:        q,
+		opts:         opts,
+		stream:       stream,
+		last:         start,
+		pruned:       start,
+		seen:         make(map[messageKey]bool),
+	}
+	// Unblock Recv when the context is done.
+	context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.stream.Close()
+	})
+	return s, nil
+}
+
+// Recv blocks until a new message is received, connecting again if the
+// connection is lost. It returns ErrStreamClosed after Close, the context's
+// error when it's done, and the last error if MaxAttempts is exceeded. It
+// gives up right away if connecting fails with ErrUnauthorized, ErrForbidden
+// or ErrNotFound.
+func (s *ReconnectingStream) Recv() (OutputDataMessage, error) {
+	for {
+		if len(s.pending) > 0 {
+			msg := s.pending[0]
+			s.pending = s.pending[1:]
+			return msg, nil
+		}
+
+		s.mu.Lock()
+		stream, closed := s.stream, s.closed
+		s.mu.Unlock()
+		if closed {
+			return OutputDataMessage{}, ErrStreamClosed
+		}
+
+		msg, err := stream.Recv()
+		if err == nil {
+			if s.remember(msg) {
+				return msg, nil
+			}
+			continue
+		}
+		if err := s.reconnect(err); err != nil {
+			return OutputDataMessage{}, err
+		}
+	}
+}
+
+// LastReceived returns the time the newest message was received, or the time
+// the stream was opened if no message has been received.
+func (s *ReconnectingStream) LastReceived() time.Time {
+	return time.Unix(0, s.last*int64(time.Millisecond))
+}
+
+// Close closes the stream and its connection. It can be called concurrently
+// with Recv.
+func (s *ReconnectingStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.cancel()
+	s.stream.Close()
+}
+
+// remember records a message and reports whether it's new.
+func (s *ReconnectingStream) remember(msg OutputDataMessage) bool {
+	k := keyOf(msg)
+	if s.seen[k] {
+		return false
+	}
+	s.seen[k] = true
+	if msg.Received > s.last {
+		s.last = msg.Received
+	}
+	// Pruning every quarter of the window rather than for every message
+	// keeps messages for up to 1.25 times the window.
+	window := int64(s.opts.DedupWindow / time.Millisecond)
+	if s.last-s.pruned >= window/4 {
+		oldest := s.last - window
+		for k := range s.seen {
+			if k.received < oldest {
+				delete(s.seen, k)
+			}
+		}
+		s.pruned = s.last
+	}
+	return true
+}
+
+// reconnect connects again after the connection was lost because of cause,
+// and back-fills the outage.
+func (s *ReconnectingStream) reconnect(cause error) error {
+	if s.ctx.Err() != nil {
+		return s.stopped()
+	}
+	s.mu.Lock()
+	lost := s.stream
+	s.mu.Unlock()
+	lost.Close()
+
+	down := time.Now()
+	s.client.log(s.ctx, slog.LevelWarn, "nbiot: output stream lost", slog.String("path", s.path), slog.Any("error", cause))
+	s.event(StreamEvent{State: StreamDisconnected, Err: cause})
+
+	err := cause
+	for attempt := 1; s.opts.MaxAttempts == 0 || attempt <= s.opts.MaxAttempts; attempt++ {
+		if sleep(s.ctx, Backoff{}.jitter(attempt, s.opts.MinBackoff, s.opts.MaxBackoff)) != nil {
+			return s.stopped()
+		}
+		s.event(StreamEvent{State: StreamReconnecting, Err: err, Attempt: attempt, Outage: time.Since(down)})
+
+		var stream *OutputStream
+		stream, err = s.client.outputStream(s.ctx, s.path)
+		if permanent(err) {
+			s.client.log(s.ctx, slog.LevelWarn, "nbiot: output stream gone", slog.String("path", s.path), slog.Any("error", err))
+			return err
+		}
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		s.stream = stream
+		// The context may have been done while dialing, after AfterFunc
+		// closed the previous stream.
+		stop := s.closed || s.ctx.Err() != nil
+		s.mu.Unlock()
+		if stop {
+			stream.Close()
+			return s.stopped()
+		}
+		if s.client.metrics != nil {
+			s.client.metrics.StreamReconnected(s.collectionID)
+		}
+
+		n, err := s.backfill()
+		if err != nil {
+			s.client.log(s.ctx, slog.LevelWarn, "nbiot: back-filling output stream failed", slog.String("path", s.path), slog.Any("error", err))
+		}
+		s.client.log(s.ctx, slog.LevelInfo, "nbiot: output stream reconnected",
+			slog.String("path", s.path), slog.Int("attempts", attempt), slog.Int("backfilled", n))
+		s.event(StreamEvent{State: StreamConnected, Err: err, Attempt: attempt, Outage: time.Since(down), Backfilled: n})
+		return nil
+	}
+	return err
+}
+
+// permanent reports whether connecting failed in a way that retrying won't
+// fix, i.e. the token is invalid or lacks access, or the collection or device
+// has been deleted.
+func permanent(err error) bool {
+	return errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) || errors.Is(err, ErrNotFound)
+}
+
+// backfill queues the stored messages received since the newest message
+// received, oldest first. It returns the number of messages queued.
+func (s *ReconnectingStream) backfill() (int, error) {
+	it := s.client.dataIterator(s.ctx, s.query.path(), DataIteratorOptions{
+		Since: s.LastReceived(),
+		Order: OldestFirst,
+	})
+	n := 0
+	for it.Next() {
+		if msg := it.Message(); s.remember(msg) {
+			s.pending = append(s.pending, msg)
+			n++
+		}
+	}
+	return n, it.Err()
+}
+
+// stopped returns the reason the stream stopped.
+func (s *ReconnectingStream) stopped() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	return s.ctx.Err()
+}
+
+func (s *ReconnectingStream) event(e StreamEvent) {
+	if s.opts.OnEvent != nil {
+		s.opts.OnEvent(e)
+	}
+}
@@ -0,0 +1,313 @@
+package nbiot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+// countingSink counts reconnects.
+type countingSink struct {
+	reconnects chan string
+}
+
+func (s countingSink) StreamOpened(string)          {}
+func (s countingSink) StreamClosed(string)          {}
+func (s countingSink) MessageReceived(string, int)  {}
+func (s countingSink) StreamReconnected(id string)  { s.reconnects <- id }
+func (s countingSink) RequestDone(m RequestMetrics) {}
+
+func TestReconnectingStream(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	sink := countingSink{reconnects: make(chan string, 10)}
+	client, err := NewWithOptions(srv.URL, srv.Token, WithMetrics(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []StreamEvent
+	stream, err := client.ReconnectingDeviceStream(collection.ID, device.ID, ReconnectOptions{
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond,
+		OnEvent:    func(e StreamEvent) { events = append(events, e) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	inject := func(payload string) {
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(payload)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recv := func(want string) {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Payload) != want {
+			t.Fatalf("got %s, want %s", msg.Payload, want)
+		}
+	}
+
+	inject("1")
+	recv("1")
+
+	// Messages sent while disconnected are back-filled, and the message
+	// received before isn't repeated even though it's in the same
+	// millisecond as the time back-filled from.
+	srv.DropStreams()
+	inject("2")
+	inject("3")
+	recv("2")
+	recv("3")
+	inject("4")
+	recv("4")
+
+	if len(events) != 3 || events[0].State != StreamDisconnected || events[1].State != StreamReconnecting ||
+		events[2].State != StreamConnected || events[2].Backfilled != 2 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if !stream.LastReceived().After(time.Now().Add(-time.Minute)) {
+		t.Fatal("unexpected last received time:", stream.LastReceived())
+	}
+	select {
+	case id := <-sink.reconnects:
+		if id != collection.ID {
+			t.Fatal("unexpected collection:", id)
+		}
+	default:
+		t.Fatal("reconnect not reported")
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		stream.Close()
+	}()
+	if _, err := stream.Recv(); !errors.Is(err, ErrStreamClosed) {
+		t.Fatal("expected ErrStreamClosed, got", err)
+	}
+}
+
+func TestReconnectingStreamContext(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	stream, err := client.ReconnectingCollectionStreamContext(ctx, collection.ID, ReconnectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+}
+
+func TestReconnectingStreamGone(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.ReconnectingCollectionStream(collection.ID, ReconnectOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// Reconnecting isn't retried once the collection is gone.
+	if err := client.DeleteCollection(collection.ID); err != nil {
+		t.Fatal(err)
+	}
+	srv.DropStreams()
+	if _, err := stream.Recv(); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+}
+
+func TestReconnectingStreamCanceledWhileDialing(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	// The context is done right after the reconnect handshake, and the
+	// interceptor waits for the stream's AfterFunc to have run before the
+	// new connection is handed to the stream.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handshakes := 0
+	cancelOnReconnect := func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			resp, err := next(ctx, req)
+			if req.Stream {
+				if handshakes++; handshakes == 2 {
+					cancel()
+					time.Sleep(50 * time.Millisecond)
+				}
+			}
+			return resp, err
+		}
+	}
+	// Without keepalive nothing else would end the new stream.
+	client, err := NewWithOptions(srv.URL, srv.Token, WithStreamKeepalive(0, 0), WithInterceptors(cancelOnReconnect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.ReconnectingCollectionStreamContext(ctx, collection.ID, ReconnectOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	srv.DropStreams()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := stream.Recv()
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal("expected context.Canceled, got", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Recv blocked on a stream opened after the context was done")
+	}
+}
+
+// countingConn counts the open connections it is used for.
+type countingConn struct {
+	net.Conn
+	open      *atomic.Int32
+	closeOnce sync.Once
+}
+
+func (c *countingConn) Close() error {
+	c.closeOnce.Do(func() { c.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// countingDialer returns a dialer that counts the open connections in open.
+func countingDialer(open *atomic.Int32) *websocket.Dialer {
+	var dialer net.Dialer
+	return &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			open.Add(1)
+			return &countingConn{Conn: conn, open: open}, nil
+		},
+	}
+}
+
+func TestReconnectingStreamClosesLostConnections(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	var open atomic.Int32
+	client, err := NewWithOptions(srv.URL, srv.Token, WithStreamDialer(countingDialer(&open)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.ReconnectingCollectionStream(collection.ID, ReconnectOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		srv.DropStreams()
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte{byte(i)}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+		if n := open.Load(); n != 1 {
+			t.Fatalf("%d connections open after %d reconnects", n, i+1)
+		}
+	}
+	stream.Close()
+	if n := open.Load(); n != 0 {
+		t.Fatalf("%d connections open after Close", n)
+	}
+}
+
+func TestReconnectingStreamDedupWindow(t *testing.T) {
+	s := &ReconnectingStream{
+		opts: ReconnectOptions{DedupWindow: time.Second},
+		seen: make(map[messageKey]bool),
+	}
+	msg := func(received int64) OutputDataMessage {
+		return OutputDataMessage{Received: received, Payload: []byte{byte(received)}}
+	}
+	for i := int64(1); i <= 10000; i++ {
+		if !s.remember(msg(i)) {
+			t.Fatal("message not new:", i)
+		}
+		if len(s.seen) > 1251 {
+			t.Fatalf("%d messages remembered with a window of 1000", len(s.seen))
+		}
+	}
+	if s.remember(msg(9500)) {
+		t.Fatal("message within the window not dropped")
+	}
+	if s.remember(msg(9000)) {
+		t.Fatal("message at the edge of the window not dropped")
+	}
+}
@@ -0,0 +1,134 @@
+package nbiot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides whether a failed request should be retried. Set it
+// with WithRetryPolicy; by default requests are not retried.
+type RetryPolicy interface {
+	// Retry is called after attempt number attempt (starting at 1) of req
+	// failed. Either resp or err is set. It returns how long to wait before
+	// the next attempt and whether to make one at all.
+	Retry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool)
+}
+
+// WithRetryPolicy makes the client retry failed requests according to p.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// Backoff is a RetryPolicy with exponential backoff and full jitter. It
+// retries on connection resets and on 429 Too Many Requests, 502 Bad
+// Gateway, 503 Service Unavailable and 504 Gateway Timeout. A Retry-After
+// header from the server is honored unless it exceeds MaxDelay.
+//
+// Only idempotent requests are retried unless RetryPatch or RetryAllMethods
+// is set. Updates in the API only set the fields they are given, so repeating
+// a PATCH has the same result unless another client changed those fields in
+// between. Set RetryPatch if that is acceptable.
+type Backoff struct {
+	MaxAttempts     int           // Maximum number of attempts; 4 if zero
+	BaseDelay       time.Duration // Delay before the first retry; 100ms if zero
+	MaxDelay        time.Duration // Upper bound for a single delay; 10s if zero
+	RetryPatch      bool          // Also retry PATCH requests
+	RetryAllMethods bool          // Also retry POST and PATCH requests
+}
+
+// Retry implements RetryPolicy.
+func (b Backoff) Retry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	maxAttempts, base, max := b.MaxAttempts, b.BaseDelay, b.MaxDelay
+	if maxAttempts == 0 {
+		maxAttempts = 4
+	}
+	if base == 0 {
+		base = 100 * time.Millisecond
+	}
+	if max == 0 {
+		max = 10 * time.Second
+	}
+
+	if attempt >= maxAttempts {
+		return 0, false
+	}
+	if !b.RetryAllMethods && !idempotent(req.Method) && !(b.RetryPatch && req.Method == http.MethodPatch) {
+		return 0, false
+	}
+	if err != nil {
+		return b.jitter(attempt, base, max), retryableError(err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	default:
+		return 0, false
+	}
+	if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		return d, d <= max
+	}
+	return b.jitter(attempt, base, max), true
+}
+
+func (b Backoff) jitter(attempt int, base, max time.Duration) time.Duration {
+	d := max
+	if attempt < 32 && base<<uint(attempt-1) < max {
+		d = base << uint(attempt-1)
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryableError(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
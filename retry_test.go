@@ -0,0 +1,96 @@
+package nbiot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"collectionId":"1"}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewWithOptions(srv.URL, "token", WithoutPing(), WithRetryPolicy(Backoff{BaseDelay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.Collection("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collection.ID != "1" || calls != 3 {
+		t.Fatal("unexpected result:", collection, calls)
+	}
+
+	// POST requests are not retried by default.
+	atomic.StoreInt32(&calls, 0)
+	_, err = client.CreateCollection(Collection{})
+	if cerr, ok := err.(ClientError); !ok || cerr.HTTPStatusCode != http.StatusServiceUnavailable || calls != 1 {
+		t.Fatal(err, calls)
+	}
+	if n := Attempts(err); n != 1 {
+		t.Fatal("unexpected number of attempts:", n)
+	}
+
+	// Nor are PATCH requests unless RetryPatch is set.
+	atomic.StoreInt32(&calls, 0)
+	if _, err := client.UpdateCollection(Collection{ID: "1"}); Attempts(err) != 1 || calls != 1 {
+		t.Fatal(err, calls)
+	}
+	client, err = NewWithOptions(srv.URL, "token", WithoutPing(), WithRetryPolicy(Backoff{BaseDelay: time.Millisecond, RetryPatch: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&calls, 0)
+	if _, err := client.UpdateCollection(Collection{ID: "1"}); err != nil || calls != 3 {
+		t.Fatal(err, calls)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	client, err := NewWithOptions(srv.URL, "token", WithoutPing(), WithRetryPolicy(Backoff{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.DeleteCollection("1")
+	if n := Attempts(err); n != 2 || calls != 2 {
+		t.Fatal("unexpected number of attempts:", n, calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		value string
+		d     time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"Wed, 01 Jan 2020 00:00:05 GMT", 5 * time.Second, true},
+		{"Tue, 31 Dec 2019 00:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	} {
+		d, ok := retryAfter(test.value, now)
+		if d != test.d || ok != test.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", test.value, d, ok, test.d, test.ok)
+		}
+	}
+}
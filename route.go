@@ -0,0 +1,51 @@
+package nbiot
+
+import "strings"
+
+// route describes an API path.
+type route struct {
+	Template     string // The path with IDs replaced, e.g. /collections/{id}/devices/{id}
+	CollectionID string
+	DeviceID     string
+}
+
+// routeParams maps path segments to the name of the parameter following them.
+var routeParams = map[string]string{
+	"collections": "{id}",
+	"devices":     "{id}",
+	"outputs":     "{id}",
+	"teams":       "{id}",
+	"members":     "{id}",
+	"invites":     "{code}",
+	"tags":        "{name}",
+}
+
+// parseRoute parses a path as used by the client. The query string is
+// ignored.
+func parseRoute(path string) route {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	if path == "/teams/accept" {
+		return route{Template: path}
+	}
+
+	var r route
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		param, ok := routeParams[segments[i]]
+		if !ok || i+1 == len(segments) {
+			continue
+		}
+		switch segments[i] {
+		case "collections":
+			r.CollectionID = segments[i+1]
+		case "devices":
+			r.DeviceID = segments[i+1]
+		}
+		segments[i+1] = param
+		i++
+	}
+	r.Template = strings.Join(segments, "/")
+	return r
+}
@@ -0,0 +1,23 @@
+package nbiot
+
+import "testing"
+
+func TestParseRoute(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want route
+	}{
+		{"/", route{Template: "/"}},
+		{"/collections", route{Template: "/collections"}},
+		{"/collections/17/devices/42", route{"/collections/{id}/devices/{id}", "17", "42"}},
+		{"/collections/17/devices/42/data?since=0&until=0&limit=0", route{"/collections/{id}/devices/{id}/data", "17", "42"}},
+		{"/collections/17/tags/devices", route{"/collections/{id}/tags/{name}", "17", ""}},
+		{"/collections/17/outputs/5/logs", route{"/collections/{id}/outputs/{id}/logs", "17", ""}},
+		{"/teams/1/invites/abc", route{Template: "/teams/{id}/invites/{code}"}},
+		{"/teams/accept", route{Template: "/teams/accept"}},
+	} {
+		if got := parseRoute(test.path); got != test.want {
+			t.Errorf("parseRoute(%q) = %+v; want %+v", test.path, got, test.want)
+		}
+	}
+}
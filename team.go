@@ -1,6 +1,7 @@
 package nbiot
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
@@ -29,53 +30,96 @@ type Member struct {
 
 // Team gets a team.
 func (c *Client) Team(id string) (Team, error) {
+	return c.TeamContext(context.Background(), id)
+}
+
+// TeamContext gets a team using the provided context.
+func (c *Client) TeamContext(ctx context.Context, id string) (Team, error) {
 	var team Team
-	err := c.get("/teams/"+id, &team)
+	err := c.get(ctx, "/teams/"+id, &team)
 	return team, err
 }
 
 // Teams gets all teams that the user belongs to.
 func (c *Client) Teams() ([]Team, error) {
+	return c.TeamsContext(context.Background())
+}
+
+// TeamsContext gets all teams that the user belongs to using the provided
+// context.
+func (c *Client) TeamsContext(ctx context.Context) ([]Team, error) {
 	var teams struct {
 		Teams []Team `json:"teams"`
 	}
-	err := c.get("/teams", &teams)
+	err := c.get(ctx, "/teams", &teams)
 	return teams.Teams, err
 }
 
 // CreateTeam creates a team.
 func (c *Client) CreateTeam(team Team) (Team, error) {
-	err := c.create("/teams", &team)
+	return c.CreateTeamContext(context.Background(), team)
+}
+
+// CreateTeamContext creates a team using the provided context.
+func (c *Client) CreateTeamContext(ctx context.Context, team Team) (Team, error) {
+	err := c.create(ctx, "/teams", &team)
 	return team, err
 }
 
 // UpdateTeam updates a team, but not its members.
 // No tags are deleted, only added or updated.
 func (c *Client) UpdateTeam(team Team) (Team, error) {
-	err := c.update("/teams/"+team.ID, &team)
+	return c.UpdateTeamContext(context.Background(), team)
+}
+
+// UpdateTeamContext updates a team, but not its members, using the provided
+// context. No tags are deleted, only added or updated.
+func (c *Client) UpdateTeamContext(ctx context.Context, team Team) (Team, error) {
+	err := c.update(ctx, "/teams/"+team.ID, &team)
 	return team, err
 }
 
 // UpdateTeamMemberRole updates the role of a team member.
 func (c *Client) UpdateTeamMemberRole(teamID, userID, role string) (Member, error) {
+	return c.UpdateTeamMemberRoleContext(context.Background(), teamID, userID, role)
+}
+
+// UpdateTeamMemberRoleContext updates the role of a team member using the
+// provided context.
+func (c *Client) UpdateTeamMemberRoleContext(ctx context.Context, teamID, userID, role string) (Member, error) {
 	m := Member{Role: role}
-	err := c.update(fmt.Sprintf("/teams/%s/members/%s", teamID, userID), &m)
+	err := c.update(ctx, fmt.Sprintf("/teams/%s/members/%s", teamID, userID), &m)
 	return m, err
 }
 
 // DeleteTeamMember deletes a team member.
 func (c *Client) DeleteTeamMember(teamID, userID string) error {
-	return c.delete(fmt.Sprintf("/teams/%s/members/%s", teamID, userID))
+	return c.DeleteTeamMemberContext(context.Background(), teamID, userID)
+}
+
+// DeleteTeamMemberContext deletes a team member using the provided context.
+func (c *Client) DeleteTeamMemberContext(ctx context.Context, teamID, userID string) error {
+	return c.delete(ctx, fmt.Sprintf("/teams/%s/members/%s", teamID, userID))
 }
 
 // DeleteTeamTag deletes a tag from a team.
 func (c *Client) DeleteTeamTag(id, name string) error {
-	return c.delete(fmt.Sprintf("/teams/%s/tags/%s", id, name))
+	return c.DeleteTeamTagContext(context.Background(), id, name)
+}
+
+// DeleteTeamTagContext deletes a tag from a team using the provided context.
+func (c *Client) DeleteTeamTagContext(ctx context.Context, id, name string) error {
+	return c.delete(ctx, fmt.Sprintf("/teams/%s/tags/%s", id, name))
 }
 
 // DeleteTeam deletes a team.
 func (c *Client) DeleteTeam(id string) error {
-	return c.delete("/teams/" + id)
+	return c.DeleteTeamContext(context.Background(), id)
+}
+
+// DeleteTeamContext deletes a team using the provided context.
+func (c *Client) DeleteTeamContext(ctx context.Context, id string) error {
+	return c.delete(ctx, "/teams/"+id)
 }
 
 // Invite is an invitation to a team.
@@ -86,34 +130,59 @@ type Invite struct {
 
 // Invite gets an invite.
 func (c *Client) Invite(teamID, code string) (Invite, error) {
+	return c.InviteContext(context.Background(), teamID, code)
+}
+
+// InviteContext gets an invite using the provided context.
+func (c *Client) InviteContext(ctx context.Context, teamID, code string) (Invite, error) {
 	var invite Invite
-	err := c.get(fmt.Sprintf("/teams/%s/invites/%s", teamID, code), &invite)
+	err := c.get(ctx, fmt.Sprintf("/teams/%s/invites/%s", teamID, code), &invite)
 	return invite, err
 }
 
 // Invites gets all invites for the team.
 func (c *Client) Invites(teamID string) ([]Invite, error) {
+	return c.InvitesContext(context.Background(), teamID)
+}
+
+// InvitesContext gets all invites for the team using the provided context.
+func (c *Client) InvitesContext(ctx context.Context, teamID string) ([]Invite, error) {
 	var invites struct {
 		Invites []Invite `json:"invites"`
 	}
-	err := c.get(fmt.Sprintf("/teams/%s/invites", teamID), &invites)
+	err := c.get(ctx, fmt.Sprintf("/teams/%s/invites", teamID), &invites)
 	return invites.Invites, err
 }
 
 // CreateInvite creates a invite.
 func (c *Client) CreateInvite(teamID string) (Invite, error) {
+	return c.CreateInviteContext(context.Background(), teamID)
+}
+
+// CreateInviteContext creates a invite using the provided context.
+func (c *Client) CreateInviteContext(ctx context.Context, teamID string) (Invite, error) {
 	var invite Invite
-	err := c.create(fmt.Sprintf("/teams/%s/invites", teamID), &invite)
+	err := c.create(ctx, fmt.Sprintf("/teams/%s/invites", teamID), &invite)
 	return invite, err
 }
 
 // AcceptInvite accepts a invite.
-func (c *Client) AcceptInvite(code string) (t Team, err error) {
-	err = c.request(http.MethodPost, "/teams/accept", &Invite{Code: code}, &t)
+func (c *Client) AcceptInvite(code string) (Team, error) {
+	return c.AcceptInviteContext(context.Background(), code)
+}
+
+// AcceptInviteContext accepts a invite using the provided context.
+func (c *Client) AcceptInviteContext(ctx context.Context, code string) (t Team, err error) {
+	err = c.request(ctx, http.MethodPost, "/teams/accept", &Invite{Code: code}, &t)
 	return t, err
 }
 
 // DeleteInvite deletes an invite.
 func (c *Client) DeleteInvite(teamID, code string) error {
-	return c.delete(fmt.Sprintf("/teams/%s/invites/%s", teamID, code))
+	return c.DeleteInviteContext(context.Background(), teamID, code)
+}
+
+// DeleteInviteContext deletes an invite using the provided context.
+func (c *Client) DeleteInviteContext(ctx context.Context, teamID, code string) error {
+	return c.delete(ctx, fmt.Sprintf("/teams/%s/invites/%s", teamID, code))
 }
@@ -0,0 +1,259 @@
+package nbiot
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"time"
+)
+
+// Column is a column of a CSVWriter or JSONLWriter.
+type Column struct {
+	Name  string
+	Value func(msg OutputDataMessage) interface{}
+}
+
+// These are the columns for the fields of OutputDataMessage.
+var (
+	DeviceIDColumn = Column{"deviceId", func(msg OutputDataMessage) interface{} { return msg.Device.ID }}
+	IMSIColumn     = Column{"imsi", func(msg OutputDataMessage) interface{} { return msg.Device.IMSI }}
+	IMEIColumn     = Column{"imei", func(msg OutputDataMessage) interface{} { return msg.Device.IMEI }}
+
+	// ReceivedColumn is the time received in RFC 3339 format with
+	// millisecond precision.
+	ReceivedColumn = Column{"received", func(msg OutputDataMessage) interface{} {
+		return msg.ReceivedTime().UTC().Format(rfc3339Millis)
+	}}
+
+	// ReceivedMillisColumn is the time received in milliseconds since the
+	// epoch.
+	ReceivedMillisColumn = Column{"received", func(msg OutputDataMessage) interface{} { return msg.Received }}
+
+	TransportColumn     = Column{"transport", func(msg OutputDataMessage) interface{} { return msg.Transport }}
+	UDPLocalPortColumn  = Column{"udpLocalPort", func(msg OutputDataMessage) interface{} { return msg.UDPMetaData.LocalPort }}
+	UDPRemotePortColumn = Column{"udpRemotePort", func(msg OutputDataMessage) interface{} { return msg.UDPMetaData.RemotePort }}
+	CoAPMethodColumn    = Column{"coapMethod", func(msg OutputDataMessage) interface{} { return msg.CoAPMetaData.Method }}
+	CoAPPathColumn      = Column{"coapPath", func(msg OutputDataMessage) interface{} { return msg.CoAPMetaData.Path }}
+
+	PayloadHexColumn    = Column{"payload", func(msg OutputDataMessage) interface{} { return hex.EncodeToString(msg.Payload) }}
+	PayloadBase64Column = Column{"payload", func(msg OutputDataMessage) interface{} { return base64.StdEncoding.EncodeToString(msg.Payload) }}
+)
+
+const rfc3339Millis = "2006-01-02T15:04:05.000Z07:00"
+
+// DefaultColumns returns the columns used by CSVWriters without any.
+func DefaultColumns() []Column {
+	return []Column{
+		DeviceIDColumn,
+		IMSIColumn,
+		IMEIColumn,
+		ReceivedColumn,
+		TransportColumn,
+		UDPLocalPortColumn,
+		UDPRemotePortColumn,
+		CoAPMethodColumn,
+		CoAPPathColumn,
+		PayloadBase64Column,
+	}
+}
+
+// TagColumn returns a column with the value of a device tag.
+func TagColumn(name string) Column {
+	return Column{name, func(msg OutputDataMessage) interface{} { return msg.Device.Tags[name] }}
+}
+
+// FieldColumn returns a column with a field decoded from the payload by
+// decode, or from the message's Fields if decode is nil. The value is empty if
+// the payload can't be decoded or the field is missing.
+func FieldColumn(name string, decode func(payload []byte) (map[string]interface{}, error)) Column {
+	return Column{name, func(msg OutputDataMessage) interface{} {
+		if decode == nil {
+			return msg.Fields[name]
+		}
+		fields, err := decode(msg.Payload)
+		if err != nil {
+			return nil
+		}
+		return fields[name]
+	}}
+}
+
+// MessageWriter writes messages, e.g. to a file.
+type MessageWriter interface {
+	Write(msg OutputDataMessage) error
+
+	// Flush writes any buffered data.
+	Flush() error
+}
+
+// WriteAll writes all messages from seq, e.g. from DataIterator.All, and
+// flushes w.
+func WriteAll(w MessageWriter, seq iter.Seq2[OutputDataMessage, error]) error {
+	for msg, err := range seq {
+		if err != nil {
+			return err
+		}
+		if err := w.Write(msg); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// CopyStream writes messages from s to w until the stream ends. Each message
+// is flushed as it is written. It returns nil if the stream is closed by the
+// server.
+func CopyStream(w MessageWriter, s *OutputStream) error {
+	for {
+		msg, err := s.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.Write(msg); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// CSVWriter writes messages as CSV with a header row.
+type CSVWriter struct {
+	w       *csv.Writer
+	columns []Column
+	header  bool // Whether the header has been written
+}
+
+// NewCSVWriter returns a writer that writes messages to w as CSV. Without any
+// columns it uses DefaultColumns.
+func NewCSVWriter(w io.Writer, columns ...Column) *CSVWriter {
+	if len(columns) == 0 {
+		columns = DefaultColumns()
+	}
+	return &CSVWriter{w: csv.NewWriter(w), columns: columns}
+}
+
+// Write writes a message as a row.
+func (w *CSVWriter) Write(msg OutputDataMessage) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	row := make([]string, len(w.columns))
+	for i, c := range w.columns {
+		row[i] = csvValue(c.Value(msg))
+	}
+	return w.w.Write(row)
+}
+
+// Flush writes any buffered data. The header is written even if there are no
+// messages.
+func (w *CSVWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *CSVWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	names := make([]string, len(w.columns))
+	for i, c := range w.columns {
+		names[i] = c.Name
+	}
+	return w.w.Write(names)
+}
+
+// csvValue formats a column value for CSV.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case time.Time:
+		return v.Format(rfc3339Millis)
+	case fmt.Stringer:
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// JSONLWriter writes messages as JSON Lines, i.e. one JSON object per line.
+type JSONLWriter struct {
+	w       *bufio.Writer
+	columns []Column
+}
+
+// NewJSONLWriter returns a writer that writes messages to w as JSON Lines.
+// With columns each object has a member per column, in order. Without any
+// the messages are written in the same format as the API uses.
+func NewJSONLWriter(w io.Writer, columns ...Column) *JSONLWriter {
+	return &JSONLWriter{w: bufio.NewWriter(w), columns: columns}
+}
+
+// Write writes a message as a line.
+func (w *JSONLWriter) Write(msg OutputDataMessage) error {
+	if len(w.columns) == 0 {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		_, err = w.w.Write(append(b, '\n'))
+		return err
+	}
+
+	// The line is built first so that a failing column doesn't leave half
+	// a line behind.
+	line := []byte{'{'}
+	for i, c := range w.columns {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		name, err := json.Marshal(c.Name)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(c.Value(msg))
+		if err != nil {
+			return fmt.Errorf("nbiot: column %s: %v", c.Name, err)
+		}
+		line = append(line, name...)
+		line = append(line, ':')
+		line = append(line, value...)
+	}
+	line = append(line, '}', '\n')
+	_, err := w.w.Write(line)
+	return err
+}
+
+// Flush writes any buffered data.
+func (w *JSONLWriter) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,122 @@
+package nbiot
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/telenordigital/nbiot-go/nbiottest"
+)
+
+func testMessage() OutputDataMessage {
+	msg := OutputDataMessage{
+		Device:    Device{ID: "d", IMSI: "1", IMEI: "2", Tags: map[string]string{"name": "a, b"}},
+		Payload:   []byte(`{"temp":21.5}`),
+		Received:  1500000000123,
+		Transport: "udp",
+	}
+	msg.UDPMetaData.LocalPort = 1234
+	msg.UDPMetaData.RemotePort = 4321
+	return msg
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	if err := w.Write(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "deviceId,imsi,imei,received,transport,udpLocalPort,udpRemotePort,coapMethod,coapPath,payload\n" +
+		"d,1,2,2017-07-14T02:40:00.123Z,udp,1234,4321,,,eyJ0ZW1wIjoyMS41fQ==\n"
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	w = NewCSVWriter(&buf, DeviceIDColumn, TagColumn("name"), ReceivedMillisColumn, PayloadHexColumn, FieldColumn("temp", decodeJSON))
+	if err := WriteAll(w, func(yield func(OutputDataMessage, error) bool) { yield(testMessage(), nil) }); err != nil {
+		t.Fatal(err)
+	}
+	want = "deviceId,name,received,payload,temp\n" +
+		`d,"a, b",1500000000123,7b2274656d70223a32312e357d,21.5` + "\n"
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := NewCSVWriter(&buf, DeviceIDColumn).Flush(); err != nil || buf.String() != "deviceId\n" {
+		t.Fatalf("expected only a header, got %q (%v)", buf.String(), err)
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJSONLWriter(&buf, DeviceIDColumn, ReceivedMillisColumn, UDPLocalPortColumn, FieldColumn("temp", decodeJSON))
+	for i := 0; i < 2; i++ {
+		if err := w.Write(testMessage()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	line := `{"deviceId":"d","received":1500000000123,"udpLocalPort":1234,"temp":21.5}` + "\n"
+	if buf.String() != line+line {
+		t.Fatalf("got %s", buf.String())
+	}
+
+	buf.Reset()
+	w = NewJSONLWriter(&buf)
+	if err := w.Write(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	var msg OutputDataMessage
+	if err := json.Unmarshal(buf.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Device.ID != "d" || msg.Received != 1500000000123 || string(msg.Payload) != `{"temp":21.5}` {
+		t.Fatal("unexpected message:", msg)
+	}
+}
+
+func TestCopyStream(t *testing.T) {
+	srv := nbiottest.NewServer()
+	defer srv.Close()
+
+	client, err := NewWithAddr(srv.URL, srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := client.CreateCollection(Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := client.CreateDevice(collection.ID, Device{IMSI: "1", IMEI: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.CollectionOutputStream(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	for _, payload := range []string{"a", "b"} {
+		if err := srv.Inject(collection.ID, device.ID, nbiottest.Message{Payload: []byte(payload), Received: time.Unix(1500000000, 0)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.Close()
+
+	var buf bytes.Buffer
+	CopyStream(NewCSVWriter(&buf, PayloadHexColumn), stream)
+	if got := strings.Split(buf.String(), "\n"); len(got) != 4 || got[1] != "61" || got[2] != "62" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}